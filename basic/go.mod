@@ -1,3 +1,8 @@
 module github.com/grindlemire/graph-builder/basic
 
 go 1.25.1
+
+require github.com/grindlemire/graph-builder/engine v0.0.0
+
+// The engine is developed in this repository alongside the examples
+replace github.com/grindlemire/graph-builder/engine => ../engine
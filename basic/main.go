@@ -1,25 +1,75 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"slices"
+	"strings"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
 	"github.com/grindlemire/graph-builder/basic/pkg/register"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run parses the flags in args and builds, prints and runs the graph, writing
+// everything to out
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("basic", flag.ContinueOnError)
+	nodes := fs.String("nodes", "", "comma-separated target node IDs to build a subgraph for (default: entire registry)")
+	plan := fs.Bool("plan", false, "print the graph and its execution levels without running it")
+	dot := fs.Bool("dot", false, "print the graph in Graphviz DOT format and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
 	// Build engine from registry (populated via init())
-	e := engine.New(register.Registry())
+	e, err := buildEngine(*nodes)
+	if err != nil {
+		return err
+	}
+	e.SetOutput(out)
+
+	if *dot {
+		return e.WriteDOT(out)
+	}
 
-	// Pretty print the graph structure
+	// Pretty print the graph structure and its execution levels
 	e.PrettyPrint()
+	if *plan {
+		return nil
+	}
 
 	// Execute in topological order
 	if err := e.Run(); err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "=== All nodes completed successfully ===")
+	return nil
+}
+
+// buildEngine builds an engine over the whole registry, or only the subgraph
+// needed for the comma-separated targets when any are given. Blank and
+// repeated IDs are ignored.
+func buildEngine(targets string) (*engine.Engine, error) {
+	var ids []string
+	for _, id := range strings.Split(targets, ",") {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
 	}
 
-	fmt.Println()
-	fmt.Println("=== All nodes completed successfully ===")
+	if len(ids) == 0 {
+		return engine.New(register.Registry()), nil
+	}
+	return engine.NewBuilder(register.Registry()).BuildFor(ids...)
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/basic/pkg/register"
+)
+
+func TestBuildEngine(t *testing.T) {
+	for _, tc := range []struct {
+		targets string
+		levels  [][]string
+	}{
+		{"node4", [][]string{{"node1"}, {"node4"}}},
+		{"node2a, node4", [][]string{{"node1"}, {"node2a", "node4"}}},
+		// Blank and repeated IDs are ignored
+		{" node4 ,, node4,", [][]string{{"node1"}, {"node4"}}},
+	} {
+		e, err := buildEngine(tc.targets)
+		if err != nil {
+			t.Fatalf("buildEngine(%q): %v", tc.targets, err)
+		}
+		levels, err := e.Levels()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(levels, tc.levels) {
+			t.Errorf("buildEngine(%q) levels = %v, want %v", tc.targets, levels, tc.levels)
+		}
+	}
+
+	// Without targets, or only blank ones, the whole registry is built
+	for _, targets := range []string{"", " , "} {
+		e, err := buildEngine(targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order, err := e.TopoOrder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(order) != len(register.Registry()) {
+			t.Errorf("buildEngine(%q) has %v, want the whole registry", targets, order)
+		}
+	}
+
+	if _, err := buildEngine("node4,missing"); err == nil || err.Error() != "unknown node: missing" {
+		t.Errorf("buildEngine with an unknown target = %v, want unknown node", err)
+	}
+}
+
+func TestRunFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args          []string
+		want, notWant []string
+	}{
+		{
+			args:    []string{"-nodes", "node4"},
+			want:    []string{"Execution Levels", "→ Running node4", "All nodes completed successfully"},
+			notWant: []string{"node2a"},
+		},
+		{
+			args:    []string{"-nodes", "node4", "-plan"},
+			want:    []string{"Dependency Graph", "Execution Levels", "Level 1:\n    → node4"},
+			notWant: []string{"→ Running", "All nodes completed"},
+		},
+		{
+			args:    []string{"-nodes", "node4", "-dot"},
+			want:    []string{"digraph", `"node1" -> "node4"`},
+			notWant: []string{"Dependency Graph", "→ Running"},
+		},
+	} {
+		var out bytes.Buffer
+		if err := run(tc.args, &out); err != nil {
+			t.Fatalf("run(%v): %v", tc.args, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("run(%v) output is missing %q:\n%s", tc.args, want, out.String())
+			}
+		}
+		for _, notWant := range tc.notWant {
+			if strings.Contains(out.String(), notWant) {
+				t.Errorf("run(%v) output has %q:\n%s", tc.args, notWant, out.String())
+			}
+		}
+	}
+
+	if err := run([]string{"-nodes", "missing"}, &bytes.Buffer{}); err == nil {
+		t.Error("run with an unknown target succeeded")
+	}
+}
@@ -3,7 +3,7 @@ package node1
 import (
 	"fmt"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 // Output is the output of the node that other nodes in the graph can use.
@@ -20,11 +20,5 @@ func FromDeps(deps map[string]engine.Result) (Output, error) {
 		return Output{}, fmt.Errorf("node1 result not found in deps")
 	}
 
-	// assert the type of the result is the Output type and handle the error
-	output, ok := result.Data.(Output)
-	if !ok {
-		return Output{}, fmt.Errorf("invalid data type for node1")
-	}
-
-	return output, nil
+	return engine.DataAs[Output](ID, result)
 }
@@ -1,10 +1,10 @@
 package node1
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
 	"github.com/grindlemire/graph-builder/basic/pkg/register"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 // ID is the unique identifier for the node. It is used to reference the node
@@ -26,8 +26,8 @@ func init() {
 
 // run the node's business logic and return a result that can be used
 // by other nodes in the graph.
-func run(deps map[string]engine.Result) (engine.Result, error) {
-	fmt.Printf("  → Running %s (no dependencies)\n", ID)
+func run(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+	engine.Printf(ctx, "  → Running %s (no dependencies)\n", ID)
 
 	// business logic goes here to produce the Output
 	output := Output{
@@ -3,7 +3,7 @@ package node3
 import (
 	"fmt"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 // Output is the output of the node that other nodes in the graph can use.
@@ -20,10 +20,5 @@ func FromDeps(deps map[string]engine.Result) (Output, error) {
 		return Output{}, fmt.Errorf("node3 result not found in deps")
 	}
 
-	output, ok := result.Data.(Output)
-	if !ok {
-		return Output{}, fmt.Errorf("invalid data type for node3")
-	}
-
-	return output, nil
+	return engine.DataAs[Output](ID, result)
 }
@@ -1,13 +1,13 @@
 package node3
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
 	"github.com/grindlemire/graph-builder/basic/pkg/nodes/node2a"
 	"github.com/grindlemire/graph-builder/basic/pkg/nodes/node2b"
 	"github.com/grindlemire/graph-builder/basic/pkg/nodes/node2c"
 	"github.com/grindlemire/graph-builder/basic/pkg/register"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 // ID is the unique identifier for the node. It is used to reference the node
@@ -27,7 +27,7 @@ func init() {
 
 // run the node's business logic and return a result that can be used
 // by other nodes in the graph. It receives outputs from its dependencies (node2a, node2b, node2c).
-func run(deps map[string]engine.Result) (engine.Result, error) {
+func run(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
 	// Extract the outputs from all dependencies using their type-safe helpers
 	n2a, err := node2a.FromDeps(deps)
 	if err != nil {
@@ -44,7 +44,7 @@ func run(deps map[string]engine.Result) (engine.Result, error) {
 		return engine.Result{}, err
 	}
 
-	fmt.Printf("  → Running %s (received: %q, %q, %q)\n", ID, n2a.Message, n2b.Message, n2c.Message)
+	engine.Printf(ctx, "  → Running %s (received: %q, %q, %q)\n", ID, n2a.Message, n2b.Message, n2c.Message)
 
 	return engine.Result{
 		ID: ID,
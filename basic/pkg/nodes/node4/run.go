@@ -1,11 +1,11 @@
 package node4
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/grindlemire/graph-builder/basic/pkg/engine"
 	"github.com/grindlemire/graph-builder/basic/pkg/nodes/node1"
 	"github.com/grindlemire/graph-builder/basic/pkg/register"
+	"github.com/grindlemire/graph-builder/engine"
 )
 
 // ID is the unique identifier for the node. It is used to reference the node
@@ -25,14 +25,14 @@ func init() {
 
 // run the node's business logic and return a result that can be used
 // by other nodes in the graph. It receives outputs from its dependencies (node1).
-func run(deps map[string]engine.Result) (engine.Result, error) {
+func run(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
 	// Extract the output from node1 using its type-safe helper
 	n1, err := node1.FromDeps(deps)
 	if err != nil {
 		return engine.Result{}, err
 	}
 
-	fmt.Printf("  → Running %s (received: %q from node1)\n", ID, n1.Message)
+	engine.Printf(ctx, "  → Running %s (received: %q from node1)\n", ID, n1.Message)
 
 	return engine.Result{
 		ID: ID,
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AssertSamePackage checks that node was written against this engine package:
+// a Node, a run func or a Runnable-like value whose Run returns this package's
+// Result. Another copy of the engine, e.g. a vendored fork, has identically
+// named but distinct types, so a node importing the wrong one otherwise only
+// shows up as a baffling type mismatch. Call it where nodes arrive untyped,
+// e.g. from a plugin, or in a test over the catalog.
+func AssertSamePackage(node any) error {
+	want := reflect.TypeFor[Result]()
+
+	t := reflect.TypeOf(node)
+	if t == nil {
+		return fmt.Errorf("nil node")
+	}
+	if t == reflect.TypeFor[Node]() {
+		return nil
+	}
+
+	var run reflect.Type
+	switch {
+	case t.Kind() == reflect.Func:
+		run = t
+	case t.Kind() == reflect.Struct && t.Name() == "Node":
+		if f, ok := t.FieldByName("Run"); ok {
+			run = f.Type
+		}
+	default:
+		if m, ok := t.MethodByName("Run"); ok {
+			run = m.Type
+		}
+	}
+	if run == nil || run.Kind() != reflect.Func || run.NumOut() != 2 {
+		return fmt.Errorf("%s is not a node: it has no Run returning (Result, error)", t)
+	}
+	if got := run.Out(0); got != want {
+		return fmt.Errorf("%s returns %s.%s, not %s.%s: it imports a different engine package",
+			t, got.PkgPath(), got.Name(), want.PkgPath(), want.Name())
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrTimedOut is returned (wrapped) when reading the output of a dependency
+// that missed its BestEffort level deadline
+var ErrTimedOut = errors.New("timed out in best-effort mode")
+
+// BestEffort gives every level a soft deadline, for pipelines such as
+// enrichment steps where a slow optional node shouldn't hold everything up.
+// Nodes that finish within the deadline contribute results as usual. Nodes
+// that don't are canceled and marked timed out, and the run continues with the
+// next level: their dependents still run, and reading a timed-out node's
+// output (FromDeps, Require, DataAs) returns an error wrapping ErrTimedOut.
+func (e *Engine) BestEffort(levelDeadline time.Duration) {
+	e.levelDeadline = levelDeadline
+}
+
+// TimedOut returns the nodes that missed their BestEffort deadline in the
+// last run, sorted by ID
+func (e *Engine) TimedOut() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	timedOut := make([]string, 0, len(e.timedOut))
+	for id := range e.timedOut {
+		timedOut = append(timedOut, id)
+	}
+	sort.Strings(timedOut)
+	return timedOut
+}
+
+// markTimedOut marks the node as timed out unless it already finished
+func (e *Engine) markTimedOut(ctx context.Context, id string) {
+	e.mu.Lock()
+	if e.finished[id] || e.timedOut[id] {
+		e.mu.Unlock()
+		return
+	}
+	e.timedOut[id] = true
+	e.finished[id] = true
+	e.mu.Unlock()
+
+	e.logf("  ⏱ %s timed out after %s\n", id, e.levelDeadline)
+	e.emit(ctx, event{Kind: eventTimedOut, Node: id, Duration: e.levelDeadline})
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// ResultCache stores node results keyed by the node's CacheKey so that later
+// runs within the node's CacheTTL can skip executing it. A cache can be shared
+// between engines (see Engine.SetCache), e.g. every engine a server builds per
+// request, and is safe for concurrent use.
+type ResultCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	now     func() time.Time
+}
+
+type cacheKey struct {
+	nodeID string
+	key    string
+}
+
+type cacheEntry struct {
+	results map[string]Result
+	expires time.Time
+}
+
+// NewResultCache creates an empty cache
+func NewResultCache() *ResultCache {
+	return &ResultCache{
+		entries: make(map[cacheKey]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns the unexpired results cached for the node and key
+func (c *ResultCache) get(nodeID, key string) (map[string]Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := cacheKey{nodeID: nodeID, key: key}
+	entry, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, k)
+		return nil, false
+	}
+	return entry.results, true
+}
+
+// put caches the results of a node run for ttl
+func (c *ResultCache) put(nodeID, key string, results map[string]Result, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[cacheKey{nodeID: nodeID, key: key}] = cacheEntry{
+		results: results,
+		expires: c.now().Add(ttl),
+	}
+}
+
+// Invalidate drops every cached result for the node
+func (c *ResultCache) Invalidate(nodeID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k.nodeID == nodeID {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"io"
+	"os"
+)
+
+// ANSI escape sequences used by PrettyPrint
+const (
+	ansiReset  = "\033[0m"
+	ansiGreen  = "\033[32m"
+	ansiBlue   = "\033[34m"
+	ansiYellow = "\033[1;33m"
+)
+
+// hubDependents is how many dependents make PrettyPrint highlight a node as a
+// hub of the graph
+const hubDependents = 3
+
+// PrettyPrintColor forces PrettyPrint's ANSI colors on or off. Without it,
+// colors are used only when the output is a terminal and NO_COLOR is unset.
+func (e *Engine) PrettyPrintColor(enabled bool) {
+	e.color = &enabled
+}
+
+// useColor reports whether PrettyPrint should emit ANSI colors to w
+func (e *Engine) useColor(w io.Writer) bool {
+	if e.color != nil {
+		return *e.color
+	}
+	if _, set := os.LookupEnv("NO_COLOR"); set {
+		return false
+	}
+	if sw, ok := w.(*syncWriter); ok {
+		w = sw.w
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps a node ID in the color for its place in the graph: hubs with
+// many dependents are highlighted, roots are green and leaves are blue.
+func colorize(id string, deps, dependents int) string {
+	switch {
+	case dependents >= hubDependents:
+		return ansiYellow + id + ansiReset
+	case deps == 0:
+		return ansiGreen + id + ansiReset
+	case dependents == 0:
+		return ansiBlue + id + ansiReset
+	}
+	return id
+}
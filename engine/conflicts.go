@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DetectWriteConflicts enables a plan-time check of the nodes' declared Writes:
+// Levels, Validate and Run fail if two nodes in the same level write the same
+// resource, since they would race when run in parallel. It is purely
+// declarative; nothing is enforced while nodes run.
+func (e *Engine) DetectWriteConflicts() {
+	e.detectWriteConflicts = true
+}
+
+// checkWriteConflicts reports every resource written by more than one node in
+// the same level. It is a no-op unless DetectWriteConflicts is enabled.
+func (e *Engine) checkWriteConflicts(levels [][]string) error {
+	if !e.detectWriteConflicts {
+		return nil
+	}
+
+	var conflicts []string
+	for levelNum, level := range levels {
+		writers := make(map[string][]string)
+		for _, id := range level {
+			for _, resource := range e.nodes[id].Writes {
+				writers[resource] = append(writers[resource], id)
+			}
+		}
+
+		resources := make([]string, 0, len(writers))
+		for resource := range writers {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		for _, resource := range resources {
+			if ids := writers[resource]; len(ids) > 1 {
+				conflicts = append(conflicts, fmt.Sprintf("level %d: %s all write %s", levelNum, strings.Join(ids, ", "), resource))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("write conflicts: %s", strings.Join(conflicts, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"errors"
+	"sort"
+)
+
+// WithContinueOnError makes every run best-effort: a failed node doesn't stop
+// the run, only its transitive dependents are skipped (with reason
+// "dependency <id> failed") while every other node still runs. Run then
+// returns all node failures joined into one error, and Results holds
+// everything that completed.
+//
+//	e := engine.New(registry, engine.WithContinueOnError())
+func WithContinueOnError() Option {
+	return func(e *Engine) {
+		e.continueOnError = true
+	}
+}
+
+// RunContinueOnError runs the graph once as if WithContinueOnError was given,
+// returning the results of everything that completed and all node failures
+// joined into one error, or nil if none failed.
+func (e *Engine) RunContinueOnError() (map[string]Result, error) {
+	prev := e.continueOnError
+	e.continueOnError = true
+	defer func() { e.continueOnError = prev }()
+
+	err := e.Run()
+	return e.Results(), err
+}
+
+// recordFailure notes a node failure the run continues past
+func (e *Engine) recordFailure(id string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failed[id] = err
+}
+
+// failures joins the recorded node failures in ID order
+func (e *Engine) failures() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	ids := make([]string, 0, len(e.failed))
+	for id := range e.failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	errs := make([]error, len(ids))
+	for i, id := range ids {
+		errs[i] = e.failed[id]
+	}
+	return errors.Join(errs...)
+}
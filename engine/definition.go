@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Definition is a declarative re-wiring of a Builder's catalog, so operators
+// can change which nodes feed which without recompiling, e.g.
+//
+//	{"nodes": [{"id": "node3", "depends_on": ["node2a", "node2b"]}]}
+//
+// Each listed node must be registered in the catalog; its depends_on replaces
+// the node's registered DependsOn entirely, so an empty or missing list makes
+// it a root. Nodes that aren't listed keep their registered edges. Only JSON
+// is supported: the engine has no dependencies, and YAML would need a
+// third-party parser.
+type Definition struct {
+	Nodes []NodeSpec `json:"nodes"`
+}
+
+// LoadDefinition returns a builder whose catalog is re-wired by the JSON
+// Definition read from r, with the same options and settings as b. The
+// definition is validated against the catalog up front, so a bad file fails
+// at load time rather than on the first request: unknown or duplicate node
+// IDs, dropped typed Inputs and everything Validate checks, such as unknown
+// dependencies and cycles, are reported together in a *ValidationError.
+func (b *Builder) LoadDefinition(r io.Reader) (*Builder, error) {
+	var def Definition
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return nil, fmt.Errorf("decoding graph definition: %w", err)
+	}
+
+	catalog := make(map[string]Node, len(b.catalog))
+	for id, node := range b.catalog {
+		catalog[id] = node
+	}
+
+	var problems []Problem
+	seen := make(map[string]bool, len(def.Nodes))
+	for _, spec := range def.Nodes {
+		node, ok := b.catalog[spec.ID]
+		switch {
+		case !ok:
+			problems = append(problems, problemf(spec.ID, "definition rewires %s, which is not in the catalog", spec.ID))
+			continue
+		case seen[spec.ID]:
+			problems = append(problems, problemf(spec.ID, "definition lists %s more than once", spec.ID))
+			continue
+		}
+		seen[spec.ID] = true
+
+		for _, in := range node.Inputs {
+			if !slices.Contains(spec.DependsOn, in.ID) {
+				problems = append(problems, problemf(spec.ID, "definition drops %s from %s, which reads it as a typed input", in.ID, spec.ID))
+			}
+		}
+		node.DependsOn = slices.Clone(spec.DependsOn)
+		node.versionReqs = nil
+		catalog[spec.ID] = node.normalize()
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	if err := New(catalog).Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Builder{
+		catalog:    catalog,
+		opts:       b.opts,
+		warnUnused: b.warnUnused,
+		enabled:    b.enabled,
+		strict:     b.strict,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Require returns the typed output of the dependency id. It is a drop-in
+// replacement for a hand-written FromDeps helper that also checks ctx first, so
+// a node bailing out mid-work gets a clean cancellation error, and reports
+// errors with the calling node's ID taken from ctx.
+//
+//	n1, err := engine.Require[node1.Output](ctx, deps, node1.ID)
+func Require[T any](ctx context.Context, deps map[string]Result, id string) (T, error) {
+	var zero T
+
+	if err := ctx.Err(); err != nil {
+		return zero, requireError(ctx, "dependency %s: %w", id, err)
+	}
+
+	result, ok := deps[id]
+	if !ok {
+		return zero, requireError(ctx, "%s result not found in deps", id)
+	}
+
+	data, err := DataAs[T](id, result)
+	if err != nil {
+		return zero, requireError(ctx, "%w", err)
+	}
+
+	return data, nil
+}
+
+// skippedData stands in for the output of a dependency that returned ErrSkip
+type skippedData struct{}
+
+// timedOutData stands in for the output of a dependency that missed its
+// BestEffort level deadline
+type timedOutData struct{}
+
+// DataAs asserts that the result of node id holds data of type T. FromDeps
+// helpers use it so a wiring mistake reports the type that was actually there:
+//
+//	invalid data type for node2a: expected node2a.Output, got node2b.Output
+func DataAs[T any](id string, result Result) (T, error) {
+	var zero T
+	if err := unavailable(id, result); err != nil {
+		return zero, err
+	}
+	data, ok := result.Data.(T)
+	if !ok {
+		return zero, fmt.Errorf("invalid data type for %s: expected %s, got %T", id, reflect.TypeFor[T](), result.Data)
+	}
+	return data, nil
+}
+
+// unavailable reports why a dependency's result holds no output, or nil
+func unavailable(id string, result Result) error {
+	switch result.Data.(type) {
+	case skippedData:
+		return fmt.Errorf("dependency %s was skipped: %w", id, ErrSkip)
+	case timedOutData:
+		return fmt.Errorf("dependency %s: %w", id, ErrTimedOut)
+	}
+	return nil
+}
+
+// ResultAs returns the typed output of the dependency id, the type assertion
+// every FromDeps helper would otherwise repeat:
+//
+//	n1, err := engine.ResultAs[node1.Output](deps, node1.ID)
+//
+// It errors with "<id> result not found in deps" if id isn't among deps, and
+// with a type mismatch like DataAs.
+func ResultAs[T any](deps map[string]Result, id string) (T, error) {
+	result, ok := deps[id]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%s result not found in deps", id)
+	}
+	return DataAs[T](id, result)
+}
+
+// ResultOf returns the typed output of node id after a run, the consumer-side
+// counterpart of FromDeps:
+//
+//	n3, err := engine.ResultOf[node3.Output](e, node3.ID)
+//
+// It errors with "node <id> has no result" if the node didn't store one, e.g.
+// because it hasn't run or was skipped, and with a type mismatch like DataAs.
+func ResultOf[T any](e *Engine, id string) (T, error) {
+	e.mu.RLock()
+	result, ok := e.resultFor(id)
+	e.mu.RUnlock()
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("node %s has no result", id)
+	}
+	return DataAs[T](id, result)
+}
+
+// requireError prefixes an error with the ID of the node executing with ctx
+func requireError(ctx context.Context, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	if caller, ok := NodeID(ctx); ok {
+		return fmt.Errorf("node %s: %w", caller, err)
+	}
+	return err
+}
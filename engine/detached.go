@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// runDetached starts a Detached node outside its level's group. It runs with
+// a context that isn't canceled when the run ends, so it can outlive the run.
+func (e *Engine) runDetached(ctx context.Context, id string, level int) {
+	e.detached.Add(1)
+	go func() {
+		defer e.detached.Done()
+		if err := e.runNode(context.WithoutCancel(ctx), id, level); err != nil {
+			e.mu.Lock()
+			e.detachedErrs = append(e.detachedErrs, err)
+			e.mu.Unlock()
+		}
+	}()
+}
+
+// WaitDetached blocks until every Detached node started by the last run has
+// finished and returns their failures joined, or nil. Their results are in
+// Results once it returns. A new run also waits for them before starting.
+func (e *Engine) WaitDetached() error {
+	e.detached.Wait()
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return errors.Join(e.detachedErrs...)
+}
+
+// checkDetached rejects Detached nodes that other nodes depend on, since
+// nothing waits for their results
+func checkDetached(nodes map[string]Node) error {
+	problems := detachedProblems(nodes)
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, p := range problems {
+		messages[i] = p.Message
+	}
+	return fmt.Errorf("detached nodes must not have dependents: %s", strings.Join(messages, "; "))
+}
+
+// detachedProblems reports every dependency on a Detached node
+func detachedProblems(nodes map[string]Node) []Problem {
+	var problems []Problem
+	for _, id := range sortedIDs(nodes) {
+		for _, dep := range nodes[id].DependsOn {
+			if producer, ok := producerOf(nodes, dep); ok && nodes[producer].Detached {
+				problems = append(problems, problemf(id, "node %s depends on detached node %s", id, producer))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// GraphDiff describes how a node catalog changed between two versions
+type GraphDiff struct {
+	// Added holds the nodes only present in the new catalog, sorted by ID
+	Added []NodeDeps
+	// Removed holds the nodes only present in the old catalog, sorted by ID
+	Removed []NodeDeps
+	// Changed holds the nodes present in both whose DependsOn differs, sorted by ID
+	Changed []DepsChange
+}
+
+// NodeDeps is a node ID with its sorted dependencies
+type NodeDeps struct {
+	ID        string
+	DependsOn []string
+}
+
+// DepsChange records a node whose dependencies changed
+type DepsChange struct {
+	ID  string
+	Old []string
+	New []string
+}
+
+// Diff compares two versions of a node catalog. Dependency order is ignored and
+// the output is sorted so the same pair of catalogs always yields the same diff.
+func Diff(old, new map[string]Node) GraphDiff {
+	var d GraphDiff
+
+	for _, id := range sortedIDs(new) {
+		newDeps := sortedDeps(new[id])
+		oldNode, existed := old[id]
+		if !existed {
+			d.Added = append(d.Added, NodeDeps{ID: id, DependsOn: newDeps})
+			continue
+		}
+		if oldDeps := sortedDeps(oldNode); !slices.Equal(oldDeps, newDeps) {
+			d.Changed = append(d.Changed, DepsChange{ID: id, Old: oldDeps, New: newDeps})
+		}
+	}
+
+	for _, id := range sortedIDs(old) {
+		if _, exists := new[id]; !exists {
+			d.Removed = append(d.Removed, NodeDeps{ID: id, DependsOn: sortedDeps(old[id])})
+		}
+	}
+
+	return d
+}
+
+// Empty reports whether the two catalogs had the same topology
+func (d GraphDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String renders the diff one change per line, prefixing added nodes with "+",
+// removed nodes with "-" and nodes with changed dependencies with "~", e.g.
+// "+ node5 (depends on: node3)".
+func (d GraphDiff) String() string {
+	if d.Empty() {
+		return "no graph changes\n"
+	}
+
+	var b strings.Builder
+	for _, n := range d.Added {
+		fmt.Fprintf(&b, "+ %s (depends on: %s)\n", n.ID, formatDeps(n.DependsOn))
+	}
+	for _, n := range d.Removed {
+		fmt.Fprintf(&b, "- %s (depends on: %s)\n", n.ID, formatDeps(n.DependsOn))
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(&b, "~ %s depends on: %s → %s\n", c.ID, formatDeps(c.Old), formatDeps(c.New))
+	}
+	return b.String()
+}
+
+// Hash returns a stable hex-encoded SHA-256 of the graph topology: the node IDs
+// and their dependency edges, independent of map iteration and DependsOn order.
+// Two engines with the same hash have an empty Diff, so it can key caches of
+// expensive graph analysis or let callers skip re-validating an unchanged graph.
+func (e *Engine) Hash() string {
+	h := sha256.New()
+	for _, id := range sortedIDs(e.nodes) {
+		// NUL and newline can't appear in the IDs we care about, so they
+		// unambiguously separate the fields
+		fmt.Fprintf(h, "%s\x00%s\n", id, strings.Join(sortedDeps(e.nodes[id]), "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func formatDeps(deps []string) string {
+	if len(deps) == 0 {
+		return "(none)"
+	}
+	return strings.Join(deps, ", ")
+}
+
+func sortedIDs(nodes map[string]Node) []string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedDeps(node Node) []string {
+	deps := append([]string(nil), node.DependsOn...)
+	sort.Strings(deps)
+	return deps
+}
@@ -0,0 +1,2161 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result holds the output of a node execution
+type Result struct {
+	ID   string
+	Data any
+
+	// Meta holds optional diagnostic key/values about the execution, such as
+	// rows_processed=1200 or cache_hit=true, kept separate from the typed Data.
+	Meta map[string]string `json:",omitempty"`
+
+	// Level is the execution level the node ran in. The engine sets it when
+	// storing the result, so nodes don't need to.
+	Level int
+}
+
+// formatMeta renders meta as sorted key=value pairs
+func formatMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + meta[k]
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// ErrHalt can be returned (or wrapped) by a node to stop the whole run successfully,
+// e.g. from a guard node that decides the rest of the pipeline is unnecessary.
+// Nodes in the same level still finish, no further levels are scheduled, and Run
+// returns nil with the results collected so far.
+var ErrHalt = errors.New("halt graph execution")
+
+// ErrSkip can be returned (or wrapped) by a node that decides from its inputs
+// not to produce a result, e.g. because there is no new data. Unlike a
+// ConditionalDeps skip, which is decided before the node runs and also skips
+// its dependents, the rest of the graph keeps running: dependents still run,
+// and reading the skipped node's output (FromDeps, Require, DataAs) returns an
+// error wrapping ErrSkip. A dependent that doesn't handle it and returns the
+// error is in turn skipped.
+var ErrSkip = errors.New("skip node")
+
+// RunFunc is the signature for a node's execution function.
+// It receives results from all dependencies. ctx carries the node's ID and
+// output writer (see Printf) and is canceled when the run is.
+type RunFunc func(ctx context.Context, deps map[string]Result) (Result, error)
+
+// MultiRunFunc is the signature for a fan-out node that emits several results
+// from a single invocation. Each result is stored under its own Result.ID, which
+// must be the node's ID or a sub-ID of the form "<node ID>/<suffix>".
+type MultiRunFunc func(ctx context.Context, deps map[string]Result) ([]Result, error)
+
+// SubIDSeparator separates a fan-out node's ID from the suffix of a sub-ID,
+// e.g. "record/0" is a result emitted by the node "record".
+const SubIDSeparator = "/"
+
+// Node represents a single node in the dependency graph
+type Node struct {
+	ID string
+	// DependsOn lists the IDs of the nodes whose results this node needs. An
+	// entry may require a minimum version of its producer, e.g. "node1@>=2"
+	// (see Version).
+	DependsOn []string
+	Run       RunFunc
+
+	// Version optionally versions the node's output shape, e.g. "2" or "1.3".
+	// Dependents can require a version in DependsOn and building fails if the
+	// registered node doesn't satisfy it. Unversioned nodes only satisfy
+	// dependents that don't ask for a version.
+	Version string
+
+	// RunMulti is an alternative to Run for fan-out nodes. When set it is used
+	// instead of Run, and dependents may reference the emitted sub-IDs directly.
+	RunMulti MultiRunFunc
+
+	// Cost is an optional estimate of how long the node takes to run. Within a
+	// level, more expensive nodes are started first, and SlowNodes compares it
+	// against the measured duration.
+	Cost time.Duration
+
+	// NonDeterministic opts the node out of VerifyIdempotent, for nodes whose
+	// output legitimately differs between runs (timestamps, random IDs, ...).
+	NonDeterministic bool
+
+	// CacheKey and CacheTTL enable result caching for expensive idempotent
+	// nodes. CacheKey derives a key from the dependency results; a later run
+	// within CacheTTL that computes the same key reuses the cached result
+	// instead of calling Run. Both must be set for caching to apply.
+	CacheKey func(deps map[string]Result) string
+	CacheTTL time.Duration
+
+	// ConditionalDeps makes edges in DependsOn conditional on the upstream
+	// result. Keys are dependency IDs from DependsOn; if any predicate returns
+	// false the node is skipped instead of run, e.g. an alert node that should
+	// only run when a check node reports a failure. Skipped nodes store no
+	// result, so their dependents are skipped too.
+	ConditionalDeps map[string]func(Result) bool
+
+	// Exclusive means the node must not run concurrently with any other node,
+	// e.g. because it mutates a shared resource without its own locking. Its
+	// level runs the other nodes first, then each exclusive node alone, so the
+	// level loses its parallelism while an exclusive node runs. Only use it
+	// when the node can't be made safe to run alongside others.
+	Exclusive bool
+
+	// ConcurrencyGroup puts the node in a named concurrency budget shared
+	// across levels, e.g. every node calling the same rate-limited API.
+	// See SetGroupLimit.
+	ConcurrencyGroup string
+
+	// Writes optionally names the logical shared resources the node writes,
+	// e.g. "user-cache". It is only used by DetectWriteConflicts.
+	Writes []string
+
+	// OptionalDeps lists dependencies from DependsOn the node can run without.
+	// When one is disabled (see Builder.SetEnabled) BuildFor drops the edge and
+	// the node runs without that result instead of the build failing.
+	OptionalDeps []string
+
+	// Inputs declares typed dependencies, e.g. engine.Input[node1.Output](node1.ID).
+	// Their IDs are added to DependsOn, and before calling Run the engine checks
+	// each one is present with the declared type, so Run can read them with
+	// engine.Value without further checks.
+	Inputs []InputSpec
+
+	// Aliases are additional IDs the node can be referenced by, e.g. its former
+	// ID during a rename so existing DependsOn references keep resolving.
+	// Dependents referencing an alias receive the result under the alias.
+	Aliases []string
+
+	// Detached marks a pure side-effect node, e.g. sending a notification.
+	// The engine starts it with its level but doesn't wait for it, so the run
+	// can finish while it is still going; WaitDetached collects its error. A
+	// detached node must not have dependents.
+	Detached bool
+
+	// After lists nodes this one must run after without consuming their
+	// results, e.g. a cache-warm node after the cache-clear node. It orders
+	// levels like DependsOn, but the results aren't passed to Run, a skipped
+	// or failed After node doesn't skip this one, and IDs not in the engine
+	// are ignored, so BuildFor doesn't pull them in.
+	After []string
+
+	// Retry retries a failing Run with backoff, so transient errors such as
+	// a flaky network call don't need a retry loop inside every node.
+	// Finalize runs once, after the last attempt. The zero value doesn't
+	// retry.
+	Retry RetryPolicy
+
+	// Adapt, if set, transforms the dependency results before Run sees them,
+	// e.g. renaming an upstream's key to the one Run expects, so the same node
+	// can be wired to differently named producers in different graphs.
+	// DependsOn and Inputs still name the actual producers. It gets its own
+	// copy of the map, and an error fails the node.
+	Adapt func(deps map[string]Result) (map[string]Result, error)
+
+	// Finalize, if set, is called once the node's Run (or RunMulti) returns,
+	// whether it succeeded or failed, e.g. to close a temp file or release a
+	// lease. It receives the result under the node's own ID and Run's error.
+	// A panic in the node is recovered first, so Finalize sees it as the
+	// error.
+	Finalize func(res Result, err error)
+
+	// versionReqs maps dependencies to the version constraint DependsOn gave
+	// them, which normalize strips from DependsOn
+	versionReqs map[string]string
+}
+
+// normalize returns the node in the form the engine works with: version
+// constraints split out of DependsOn and Inputs added to it
+func (n Node) normalize() Node {
+	return n.withVersionDeps().withInputDeps()
+}
+
+// execute runs the node and returns the results to store keyed by ID
+func (n Node) execute(ctx context.Context, deps map[string]Result) (_ map[string]Result, err error) {
+	// own is the node's result under its own ID, handed to Finalize
+	var own Result
+	if n.Finalize != nil {
+		defer func() { n.Finalize(own, err) }()
+	}
+	// A panicking node fails on its own instead of crashing the process
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	if err := n.checkInputs(deps); err != nil {
+		return nil, err
+	}
+	if n.Adapt != nil {
+		if deps, err = n.Adapt(maps.Clone(deps)); err != nil {
+			return nil, fmt.Errorf("adapting dependencies: %w", err)
+		}
+	}
+
+	if n.RunMulti == nil {
+		err = n.Retry.do(ctx, n.ID, func() (err error) {
+			own, err = n.Run(ctx, deps)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]Result{n.ID: own}, nil
+	}
+
+	var results []Result
+	err = n.Retry.do(ctx, n.ID, func() (err error) {
+		results, err = n.RunMulti(ctx, deps)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(results, func(r Result) bool { return r.ID == n.ID }); i >= 0 {
+		own = results[i]
+	}
+	out := make(map[string]Result, len(results))
+	for _, result := range results {
+		if result.ID != n.ID && !strings.HasPrefix(result.ID, n.ID+SubIDSeparator) {
+			return nil, fmt.Errorf("result %q is outside the node's ID namespace", result.ID)
+		}
+		if _, dup := out[result.ID]; dup {
+			return nil, fmt.Errorf("duplicate result %q", result.ID)
+		}
+		out[result.ID] = result
+	}
+	return out, nil
+}
+
+// producerOf maps a dependency reference to the ID of the node that produces it.
+// Plain node IDs map to themselves, aliases to the node that declares them and
+// sub-IDs to their fan-out node.
+func producerOf(nodes map[string]Node, ref string) (string, bool) {
+	if _, ok := nodes[ref]; ok {
+		return ref, true
+	}
+	if canonical, ok := aliasOf(nodes, ref); ok {
+		return canonical, true
+	}
+	prefix, _, found := strings.Cut(ref, SubIDSeparator)
+	if !found {
+		return "", false
+	}
+	if node, ok := nodes[prefix]; ok && node.RunMulti != nil {
+		return prefix, true
+	}
+	return "", false
+}
+
+// aliasOf returns the ID of the node that declares ref as an alias
+func aliasOf(nodes map[string]Node, ref string) (string, bool) {
+	for id, node := range nodes {
+		if slices.Contains(node.Aliases, ref) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// resultFor looks up the stored result for a dependency reference, following
+// aliases to the canonical node's result. Callers must hold e.mu.
+func (e *Engine) resultFor(ref string) (Result, bool) {
+	if result, ok := e.results[ref]; ok {
+		return result, true
+	}
+	if canonical, ok := aliasOf(e.nodes, ref); ok {
+		result, ok := e.results[canonical]
+		return result, ok
+	}
+	return Result{}, false
+}
+
+// AliasUsage records a reference to a node through one of its aliases
+type AliasUsage struct {
+	// Node is the node whose DependsOn uses the alias, or empty when the alias
+	// was requested as a BuildFor target
+	Node      string
+	Alias     string
+	Canonical string
+}
+
+// AliasUsages lists every reference in the engine that goes through an alias,
+// so stragglers can be tracked down and migrated to the canonical ID.
+func (e *Engine) AliasUsages() []AliasUsage {
+	var usages []AliasUsage
+	for _, target := range e.targets {
+		if canonical, ok := aliasOf(e.nodes, target); ok && target != canonical {
+			usages = append(usages, AliasUsage{Alias: target, Canonical: canonical})
+		}
+	}
+	for _, id := range sortedIDs(e.nodes) {
+		for _, dep := range sortedDeps(e.nodes[id]) {
+			if _, direct := e.nodes[dep]; direct {
+				continue
+			}
+			if canonical, ok := aliasOf(e.nodes, dep); ok {
+				usages = append(usages, AliasUsage{Node: id, Alias: dep, Canonical: canonical})
+			}
+		}
+	}
+	return usages
+}
+
+// Engine manages the dependency graph and execution
+type Engine struct {
+	nodes   map[string]Node
+	results map[string]Result
+	mu      sync.RWMutex
+
+	// targets are the node IDs requested via Builder.BuildFor. Empty for
+	// engines built directly with New.
+	targets []string
+
+	// graphLabel names the engine's runs for metrics (see SetGraphName)
+	graphLabel string
+
+	// maxParallelism caps how many nodes run concurrently within a level.
+	// levelParallelism overrides it for specific level indices. Zero means unlimited.
+	maxParallelism   int
+	levelParallelism map[int]int
+
+	// groupSlots bounds the concurrently running nodes of each
+	// ConcurrencyGroup with a limit (see SetGroupLimit)
+	groupSlots map[string]chan struct{}
+
+	// out receives all engine and node output. When bufferNodeOutput is set
+	// each node's output is held until it completes and flushed as one block.
+	out              *syncWriter
+	bufferNodeOutput bool
+
+	// durations holds how long each node took in the last run
+	durations map[string]time.Duration
+
+	// skipped maps the nodes skipped in the last run to the reason why.
+	// skippedByNode marks the ones that skipped themselves with ErrSkip.
+	skipped       map[string]string
+	skippedByNode map[string]bool
+
+	// levelDeadline is the soft per-level deadline set by BestEffort and
+	// timedOut holds the nodes that missed it in the last run
+	levelDeadline time.Duration
+	timedOut      map[string]bool
+
+	// finished holds the nodes that completed, were skipped or were served
+	// from cache in the last run. It backs Progress.
+	finished map[string]bool
+
+	// seeds are externally supplied results that survive Reset
+	seeds map[string]Result
+
+	// resultGC enables dropping results once all dependents have run.
+	// gcRemaining counts the dependents still waiting on each node during a run
+	// and collected records the nodes whose results were dropped.
+	resultGC    bool
+	gcRemaining map[string]int
+	collected   map[string]bool
+
+	// cache holds results of nodes that declare a CacheKey
+	cache *ResultCache
+
+	// strict enables post-run invariant checks (see SetStrict)
+	strict bool
+
+	// maxResultBytes caps the JSON size of each result (see MaxResultBytes)
+	maxResultBytes int
+
+	// seed drives any randomized tie-breaking in the scheduler (see WithSeed)
+	seed int64
+
+	// runID identifies the current or most recent run (see LastRunID)
+	runID string
+
+	// plan holds levels precomputed by Builder.BuildForCached. It is shared
+	// between engines, so it is only ever copied, and ignored once seeds
+	// change which nodes run.
+	plan [][]string
+
+	// resources are the shared dependencies handed to nodes (see WithResource)
+	resources map[string]any
+
+	// listeners receive every run event (see WithJSONLogs)
+	listeners []func(event)
+
+	// selected restricts a RunWhere run to these nodes; nil runs everything
+	selected map[string]bool
+
+	// rerun restricts a Watch re-run to these nodes, keeping the results of
+	// the others; nil runs everything
+	rerun map[string]bool
+
+	// scheduleGate, set only by tests, holds each node until its channel
+	// is closed (see setScheduleGate)
+	scheduleGate func(nodeID string) <-chan struct{}
+
+	// detectWriteConflicts enables the plan-time Writes check
+	// (see DetectWriteConflicts)
+	detectWriteConflicts bool
+
+	// detached tracks the Detached nodes still running and detachedErrs
+	// collects their failures (see WaitDetached)
+	detached     sync.WaitGroup
+	detachedErrs []error
+
+	// executions records the nodes whose Run returned in the current run, in
+	// completion order (see Executions)
+	executions []Execution
+	runStart   time.Time
+
+	// rateLimiters pace the nodes of a ConcurrencyGroup (see WithRateLimiter)
+	rateLimiters map[string]RateLimiter
+
+	// nodeErrors holds the error of every node that failed in the last run,
+	// runEnd and runErr when and how it ended (see Report)
+	nodeErrors map[string]error
+	runEnd     time.Time
+	runErr     error
+
+	// runDone is set once a run returned. Nodes it abandoned, still in
+	// flight after an interrupt, then drop their results (see lateResult).
+	runDone bool
+
+	// metrics receives run measurements (see WithMetrics)
+	metrics MetricsCollector
+
+	// middleware wraps the Run of every node (see Use)
+	middleware []Middleware
+
+	// readyScheduler starts nodes as soon as their dependencies finished
+	// instead of level by level (see WithReadyScheduler)
+	readyScheduler bool
+
+	// failFast stops waiting for in-flight nodes once one of them failed
+	// (see FailFast)
+	failFast bool
+
+	// continueOnError makes failed nodes skip their dependents instead of
+	// failing the run; failed holds their errors (see WithContinueOnError)
+	continueOnError bool
+	failed          map[string]error
+
+	// errorFormatter renders node failures; nil uses the default
+	// (see SetErrorFormatter)
+	errorFormatter func(nodeID string, err error) string
+
+	// color forces PrettyPrint's colors on or off; nil detects a terminal
+	// (see PrettyPrintColor)
+	color *bool
+}
+
+// Option configures an Engine at construction, see New
+type Option func(*Engine)
+
+// New creates an engine from a registry of nodes. The engine keeps its own copy
+// of the map, so later changes to the registry don't affect it and changes to
+// the engine (e.g. OverrideRun) don't leak into the registry.
+func New(registry map[string]Node, opts ...Option) *Engine {
+	nodes := make(map[string]Node, len(registry))
+	for id, node := range registry {
+		nodes[id] = node.normalize()
+	}
+
+	e := &Engine{
+		nodes:         nodes,
+		results:       make(map[string]Result),
+		out:           &syncWriter{w: os.Stdout},
+		durations:     make(map[string]time.Duration),
+		skipped:       make(map[string]string),
+		skippedByNode: make(map[string]bool),
+		timedOut:      make(map[string]bool),
+		finished:      make(map[string]bool),
+		failed:        make(map[string]error),
+		nodeErrors:    make(map[string]error),
+		cache:         NewResultCache(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Clone returns an engine with the same nodes and configuration but none of
+// this engine's run state: results, durations, skips and the run ID start
+// fresh, while seeds are carried over like Reset does. The result cache,
+// resources, JSON log writers and ConcurrencyGroup budgets are shared with the
+// original, so clones running at the same time still respect one group limit.
+// Use a clone per goroutine to run the same graph concurrently.
+func (e *Engine) Clone() *Engine {
+	c := New(e.nodes)
+
+	c.targets = slices.Clone(e.targets)
+	c.graphLabel = e.graphLabel
+	c.maxParallelism = e.maxParallelism
+	c.levelParallelism = maps.Clone(e.levelParallelism)
+	c.groupSlots = maps.Clone(e.groupSlots)
+	c.rateLimiters = maps.Clone(e.rateLimiters)
+	c.out = e.out
+	c.bufferNodeOutput = e.bufferNodeOutput
+	c.levelDeadline = e.levelDeadline
+	c.resultGC = e.resultGC
+	c.cache = e.cache
+	c.strict = e.strict
+	c.maxResultBytes = e.maxResultBytes
+	c.seed = e.seed
+	c.plan = e.plan
+	c.resources = e.resources
+	c.listeners = slices.Clone(e.listeners)
+	c.detectWriteConflicts = e.detectWriteConflicts
+	c.color = e.color
+	c.errorFormatter = e.errorFormatter
+	c.failFast = e.failFast
+	c.readyScheduler = e.readyScheduler
+	c.middleware = slices.Clone(e.middleware)
+	c.metrics = e.metrics
+	c.continueOnError = e.continueOnError
+
+	e.mu.RLock()
+	for _, result := range e.seeds {
+		c.Seed(result)
+	}
+	e.mu.RUnlock()
+	return c
+}
+
+// setScheduleGate lets a test decide exactly when each node may start: a
+// node's Run is only called once the channel returned for its ID is closed.
+// This reproduces ordering-sensitive bugs deterministically, e.g. forcing one
+// node of a level to finish before its sibling, without time.Sleep. It is
+// unexported so only tests can reach it (see export_test.go); when unset it
+// costs a nil check per node.
+func (e *Engine) setScheduleGate(gate func(nodeID string) <-chan struct{}) {
+	e.scheduleGate = gate
+}
+
+// SetCache replaces the engine's result cache, which by default only lives as
+// long as the engine. Share one cache between engines to reuse results across
+// engines built per request.
+func (e *Engine) SetCache(c *ResultCache) {
+	e.cache = c
+}
+
+// SetOutput redirects everything the engine and its nodes print, which defaults
+// to os.Stdout. Use io.Discard to silence it.
+func (e *Engine) SetOutput(w io.Writer) {
+	e.out = &syncWriter{w: w}
+}
+
+// BufferNodeOutput makes each node's output (written via Printf) collect in a
+// buffer that is flushed as one block when the node finishes, so lines from
+// nodes running in parallel don't interleave.
+func (e *Engine) BufferNodeOutput(enabled bool) {
+	e.bufferNodeOutput = enabled
+}
+
+// SetMaxParallelism caps the number of nodes that run concurrently within a level,
+// or across the graph with WithReadyScheduler. A value of zero or less removes the limit.
+func (e *Engine) SetMaxParallelism(max int) {
+	e.maxParallelism = max
+}
+
+// WithMaxConcurrency caps the number of node goroutines running at once, so a
+// level with hundreds of nodes doesn't flood the services they call. Levels
+// run one after another, so this bounds the whole run; it sets the same limit
+// as SetMaxParallelism. Detached nodes run outside the cap.
+func WithMaxConcurrency(n int) Option {
+	return func(e *Engine) {
+		e.SetMaxParallelism(n)
+	}
+}
+
+// SetLevelParallelism overrides the global parallelism limit for the level at the
+// given index. Level indices match the execution levels shown by PrettyPrint.
+// A max of zero or less makes the level unlimited regardless of the global setting.
+func (e *Engine) SetLevelParallelism(level int, max int) {
+	if e.levelParallelism == nil {
+		e.levelParallelism = make(map[int]int)
+	}
+	e.levelParallelism[level] = max
+}
+
+// SetGroupLimit caps how many nodes of a ConcurrencyGroup run at once, across
+// all levels, e.g. SetGroupLimit("external-api", 5) while unrelated nodes run
+// freely. It is more targeted than SetMaxParallelism, which applies to every
+// node of a level. A max of zero or less removes the limit. Call it before
+// running.
+func (e *Engine) SetGroupLimit(group string, max int) {
+	if e.groupSlots == nil {
+		e.groupSlots = make(map[string]chan struct{})
+	}
+	if max <= 0 {
+		delete(e.groupSlots, group)
+		return
+	}
+	e.groupSlots[group] = make(chan struct{}, max)
+}
+
+// RateLimiter paces node starts; *rate.Limiter from golang.org/x/time/rate
+// satisfies it. Wait blocks until the next start is allowed or ctx is done.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter makes every node of a ConcurrencyGroup wait for rl before
+// running, e.g. rate.NewLimiter(10, 1) for an API allowing 10 calls a second.
+// Unlike SetGroupLimit, which bounds how many run at once, it bounds how many
+// start per second. Waiting respects the run's context. A nil rl removes the
+// limiter. It returns the engine for chaining.
+func (e *Engine) WithRateLimiter(group string, rl RateLimiter) *Engine {
+	if e.rateLimiters == nil {
+		e.rateLimiters = make(map[string]RateLimiter)
+	}
+	if rl == nil {
+		delete(e.rateLimiters, group)
+		return e
+	}
+	e.rateLimiters[group] = rl
+	return e
+}
+
+// parallelismFor returns the concurrency limit for a level, falling back to the
+// global limit when the level has no override. Zero means unlimited.
+func (e *Engine) parallelismFor(level int) int {
+	if max, ok := e.levelParallelism[level]; ok {
+		return max
+	}
+	return e.maxParallelism
+}
+
+// SetStrict enables cheap correctness checks on every run. After a run that
+// executed all levels, every node must have stored a result; otherwise Run fails
+// with "node <id> completed without storing a result" rather than silently
+// returning nil. Skipped nodes and fan-out nodes, which may emit no results,
+// are exempt, and results dropped by EnableResultGC count as stored. Strict
+// mode also fails a node that produces nil Data while other nodes depend on
+// it; leaf nodes may return nil data.
+func (e *Engine) SetStrict(enabled bool) {
+	e.strict = enabled
+}
+
+// WithSeed pins the seed used for any randomized tie-breaking in the
+// scheduler, so that a run's node start order can be reproduced when chasing
+// a bug. The level scheduler starts nodes in a fixed order; with
+// WithReadyScheduler a non-zero seed shuffles nodes that become ready at the
+// same time before ordering them by Cost. It returns the engine for chaining.
+func (e *Engine) WithSeed(seed int64) *Engine {
+	e.seed = seed
+	return e
+}
+
+// OverrideRun replaces the Run of a node in this engine, e.g. to stub a node that
+// calls an external system in an integration test while exercising the real
+// wiring and downstream logic. The override replaces any RunMulti and
+// Finalize and disables result caching for the node. It errors if the node
+// isn't in the engine.
+func (e *Engine) OverrideRun(id string, fn RunFunc) error {
+	node, ok := e.nodes[id]
+	if !ok {
+		return fmt.Errorf("unknown node: %s", id)
+	}
+	node.Run = fn
+	node.RunMulti = nil
+	node.Finalize = nil
+	node.CacheKey = nil
+	e.nodes[id] = node
+	return nil
+}
+
+// PrettyPrint outputs a visual representation of the dependency graph to the
+// engine's output. On a terminal node IDs are colored by their place in the
+// graph (see PrettyPrintColor).
+func (e *Engine) PrettyPrint() {
+	e.PrettyPrintTo(e.out)
+}
+
+// PrettyString returns PrettyPrint's rendering, e.g. for a test to assert on
+// or a server to return in a response. It has no colors unless forced with
+// PrettyPrintColor.
+func (e *Engine) PrettyString() string {
+	var b strings.Builder
+	e.PrettyPrintTo(&b)
+	return b.String()
+}
+
+// PrettyPrintTo writes PrettyPrint's rendering to w instead of the engine's
+// output
+func (e *Engine) PrettyPrintTo(w io.Writer) {
+	fmt.Fprintln(w, "┌─────────────────────────────────────┐")
+	fmt.Fprintln(w, "│         Dependency Graph            │")
+	fmt.Fprintln(w, "└─────────────────────────────────────┘")
+
+	// Get sorted node IDs for consistent output
+	ids := make([]string, 0, len(e.nodes))
+	for id := range e.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Build reverse map (who depends on me)
+	dependents := make(map[string][]string)
+	for _, node := range e.nodes {
+		for _, dep := range node.DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok {
+				dependents[producer] = append(dependents[producer], node.ID)
+			}
+		}
+	}
+
+	color := e.useColor(w)
+	name := func(id string) string {
+		if !color {
+			return id
+		}
+		return colorize(id, len(e.nodes[id].DependsOn), len(dependents[id]))
+	}
+
+	for _, id := range ids {
+		node := e.nodes[id]
+		fmt.Fprintf(w, "\n  ◉ %s\n", name(id))
+
+		if len(node.DependsOn) > 0 {
+			deps := sortedDeps(node)
+			for i, dep := range deps {
+				if _, direct := e.nodes[dep]; direct {
+					continue
+				}
+				if canonical, ok := aliasOf(e.nodes, dep); ok {
+					deps[i] = fmt.Sprintf("%s (alias of %s)", dep, canonical)
+				}
+			}
+			fmt.Fprintf(w, "    ├─ depends on: %s\n", strings.Join(deps, ", "))
+		} else {
+			fmt.Fprintf(w, "    ├─ depends on: (none - root node)\n")
+		}
+
+		if deps, ok := dependents[id]; ok && len(deps) > 0 {
+			sort.Strings(deps)
+			fmt.Fprintf(w, "    └─ required by: %s\n", strings.Join(deps, ", "))
+		} else {
+			fmt.Fprintf(w, "    └─ required by: (none - leaf node)\n")
+		}
+	}
+
+	// Show execution levels
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		fmt.Fprintf(w, "\n  ⚠ Error computing levels: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "\n\n")
+	fmt.Fprintln(w, "┌─────────────────────────────────────┐")
+	fmt.Fprintln(w, "│         Execution Levels            │")
+	fmt.Fprintln(w, "└─────────────────────────────────────┘")
+
+	for i, level := range levels {
+		parallel := ""
+		if len(level) > 1 {
+			parallel = " (parallel)"
+		}
+		fmt.Fprintf(w, "\n  Level %d%s:\n", i, parallel)
+		for _, id := range level {
+			fmt.Fprintf(w, "    → %s\n", name(id))
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// maxSummaryLen caps how much of a result PrettyPrintResults shows per node
+const maxSummaryLen = 80
+
+// PrettyPrintResults prints the graph level by level with a one-line summary
+// of each node's Result.Data: its String method if it has one, otherwise its
+// %+v formatting, truncated to keep large payloads readable. Nodes that
+// haven't produced a result are marked as pending, skipped or collected.
+func (e *Engine) PrettyPrintResults() {
+	fmt.Fprintln(e.out, "┌─────────────────────────────────────┐")
+	fmt.Fprintln(e.out, "│            Graph Results            │")
+	fmt.Fprintln(e.out, "└─────────────────────────────────────┘")
+
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		fmt.Fprintf(e.out, "\n  ⚠ Error computing levels: %v\n", err)
+		return
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for i, level := range levels {
+		fmt.Fprintf(e.out, "\n  Level %d:\n", i)
+		for _, id := range level {
+			fmt.Fprintf(e.out, "    ◉ %s\n", id)
+
+			var resultIDs []string
+			for resultID := range e.results {
+				if resultID == id || strings.HasPrefix(resultID, id+SubIDSeparator) {
+					resultIDs = append(resultIDs, resultID)
+				}
+			}
+			sort.Strings(resultIDs)
+
+			switch {
+			case len(resultIDs) > 0:
+				for _, resultID := range resultIDs {
+					label := "result"
+					if resultID != id {
+						label = resultID
+					}
+					fmt.Fprintf(e.out, "      └─ %s: %s\n", label, summarize(e.results[resultID].Data))
+				}
+			case e.skipped[id] != "":
+				fmt.Fprintf(e.out, "      └─ (skipped: %s)\n", e.skipped[id])
+			case e.timedOut[id]:
+				fmt.Fprintf(e.out, "      └─ (timed out)\n")
+			case e.collected[id]:
+				fmt.Fprintf(e.out, "      └─ (result released by EnableResultGC)\n")
+			default:
+				fmt.Fprintf(e.out, "      └─ (no result yet)\n")
+			}
+		}
+	}
+	fmt.Fprintln(e.out)
+}
+
+// summarize renders data on one line of at most maxSummaryLen runes
+func summarize(data any) string {
+	var s string
+	if stringer, ok := data.(fmt.Stringer); ok {
+		s = stringer.String()
+	} else {
+		s = fmt.Sprintf("%+v", data)
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > maxSummaryLen {
+		s = string(runes[:maxSummaryLen-1]) + "…"
+	}
+	return s
+}
+
+// Run executes all nodes in parallel where possible.
+// Nodes are grouped into levels based on dependencies.
+// All nodes in a level run concurrently, levels execute sequentially.
+// Run is not safe to call concurrently on the same engine, since the runs
+// would share its results; use RunIsolated, or give each goroutine its own
+// engine with Clone.
+func (e *Engine) Run() error {
+	return e.RunContext(context.Background())
+}
+
+// RunIsolated runs a Clone of the engine and returns that run's results
+// instead of storing them on e, so one built engine can serve any number of
+// concurrent callers, e.g. HTTP requests, without their state mixing. On
+// failure it returns the results stored before the error alongside it. The
+// map is a copy the caller owns: nodes abandoned by an interrupted run never
+// write into it.
+func (e *Engine) RunIsolated(ctx context.Context) (map[string]Result, error) {
+	c := e.Clone()
+	err := c.RunContext(ctx)
+	return c.Results(), err
+}
+
+// InterruptError is returned when a run's context is done before every level
+// has finished. It records the level that was executing at the time.
+type InterruptError struct {
+	Level int
+	Err   error
+}
+
+func (e *InterruptError) Error() string {
+	return fmt.Sprintf("run interrupted during level %d: %v", e.Level, e.Err)
+}
+
+func (e *InterruptError) Unwrap() error {
+	return e.Err
+}
+
+// RunWithDeadline runs the graph and fails with an *InterruptError wrapping
+// context.DeadlineExceeded if it hasn't completed within d. This bounds the whole
+// run regardless of how the time is spread across nodes. In-flight nodes see
+// their ctx canceled; nodes that ignore it are abandoned rather than awaited,
+// and whatever they return afterwards is dropped.
+func (e *Engine) RunWithDeadline(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return e.RunContext(ctx)
+}
+
+// RunContext is like Run but passes ctx through to every node. If ctx is done
+// before the run finishes it returns an *InterruptError without waiting for
+// in-flight nodes; results they produce after that are dropped.
+func (e *Engine) RunContext(ctx context.Context) error {
+	err := e.run(ctx)
+	if e.continueOnError {
+		err = errors.Join(err, e.failures())
+	}
+	e.mu.Lock()
+	e.runEnd = time.Now()
+	e.runErr = err
+	e.mu.Unlock()
+	return err
+}
+
+// run plans the graph and executes it with the configured scheduler
+func (e *Engine) run(ctx context.Context) error {
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return err
+	}
+	if err := e.checkWriteConflicts(levels); err != nil {
+		return err
+	}
+
+	// Detached nodes of an earlier run may still be writing results
+	e.detached.Wait()
+
+	e.startResultGC()
+	defer e.stopResultGC()
+
+	runID := newRunID()
+	e.mu.Lock()
+	e.runID = runID
+	e.runStart = time.Now()
+	e.runEnd = time.Time{}
+	e.runErr = nil
+	e.runDone = false
+	e.executions = nil
+	e.failed = make(map[string]error)
+	e.nodeErrors = make(map[string]error)
+	// A Watch re-run keeps the state of the nodes it doesn't re-run; it
+	// invalidated the affected ones itself
+	if e.rerun == nil {
+		e.skipped = make(map[string]string)
+		e.skippedByNode = make(map[string]bool)
+		e.timedOut = make(map[string]bool)
+		e.durations = make(map[string]time.Duration)
+		e.finished = make(map[string]bool)
+	}
+	e.mu.Unlock()
+	ctx = withRunID(ctx, runID)
+	defer func() {
+		e.mu.Lock()
+		e.runDone = true
+		e.mu.Unlock()
+	}()
+	if e.metrics != nil {
+		e.metrics.RunStarted(e.graphName())
+	}
+
+	fmt.Fprintf(e.out, "\n\n")
+	fmt.Fprintln(e.out, "┌─────────────────────────────────────┐")
+	fmt.Fprintln(e.out, "│           Executing Graph           │")
+	fmt.Fprintln(e.out, "└─────────────────────────────────────┘")
+	e.logf("run %s\n", runID)
+
+	var halted bool
+	if e.readyScheduler {
+		halted, err = e.runReady(ctx, levels)
+	} else {
+		halted, err = e.runLevels(ctx, levels)
+	}
+	if err != nil || halted {
+		return err
+	}
+
+	if e.strict {
+		return e.checkAllStored()
+	}
+	return nil
+}
+
+// runLevels executes the levels one after another, each level waiting for the
+// previous one to finish. It reports whether a node halted the run.
+func (e *Engine) runLevels(ctx context.Context, levels [][]string) (bool, error) {
+	for levelNum, level := range levels {
+		if e.rerun != nil {
+			level = slices.DeleteFunc(level, func(id string) bool { return !e.rerun[id] })
+			if len(level) == 0 {
+				continue
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return false, &InterruptError{Level: levelNum, Err: err}
+		}
+
+		if len(level) > 1 {
+			e.logf("\n⚡ Level %d: executing %d nodes in parallel [%s]\n", levelNum, len(level), strings.Join(level, ", "))
+		} else {
+			e.logf("\n◆ Level %d: executing [%s]\n", levelNum, level[0])
+		}
+		e.emit(ctx, event{Kind: eventLevelStarted, Level: levelNum, Nodes: level})
+
+		// The level's nodes share a group: the first failure cancels the
+		// context of the others. Exclusive nodes run once the nodes started
+		// before them finished, and block the rest of the level until done.
+		levelCtx, cancelLevel := ctx, context.CancelFunc(func() {})
+		if e.levelDeadline > 0 {
+			levelCtx, cancelLevel = context.WithTimeout(ctx, e.levelDeadline)
+		}
+
+		g := newGroup(levelCtx, e.parallelismFor(levelNum))
+		g.failFast = e.failFast
+		for _, id := range e.exclusiveLast(e.costOrder(level)) {
+			if e.failFast && g.Err() != nil {
+				break
+			}
+			if e.nodes[id].Detached {
+				e.runDetached(ctx, id, levelNum)
+				continue
+			}
+			exclusive := e.nodes[id].Exclusive
+			if exclusive && g.Wait() != nil {
+				break
+			}
+			started := g.Go(func(ctx context.Context) error {
+				err := e.runNode(ctx, id, levelNum)
+				if err != nil && e.levelDeadline > 0 && levelCtx.Err() == context.DeadlineExceeded {
+					// Failing after the soft deadline counts as timing out
+					e.markTimedOut(ctx, id)
+					return nil
+				}
+				if err != nil && e.continueOnError && !errors.Is(err, ErrHalt) {
+					e.recordFailure(id, err)
+					return nil
+				}
+				return err
+			})
+			if !started || exclusive && g.Wait() != nil {
+				break
+			}
+		}
+
+		err := g.Wait()
+		g.cancel(nil)
+		cancelLevel()
+		if ctx.Err() != nil {
+			return false, &InterruptError{Level: levelNum, Err: ctx.Err()}
+		}
+		if levelCtx.Err() == context.DeadlineExceeded {
+			for _, id := range level {
+				e.markTimedOut(ctx, id)
+			}
+			err = g.Err()
+		}
+		e.emit(ctx, event{Kind: eventLevelCompleted, Level: levelNum, Nodes: level})
+
+		// Genuine failures take precedence over a halt requested by a
+		// sibling in the same level
+		if err != nil {
+			return false, err
+		}
+		if g.Halted() {
+			e.logf("\n■ Halted after level %d\n", levelNum)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FailFast makes a run return as soon as a node fails. A failure always
+// cancels the contexts of the other in-flight nodes, but by default the run
+// still waits for them to return before reporting it; in fail-fast mode it
+// doesn't, and nothing else is started after the failure, Detached nodes
+// included. The canceled nodes wind down in the background and whatever they
+// return afterwards is dropped, so a slow node that ignores its context no
+// longer delays the error.
+func (e *Engine) FailFast() {
+	e.failFast = true
+}
+
+// ErrResultTooLarge is the error of a node whose output exceeds the engine's
+// MaxResultBytes
+var ErrResultTooLarge = errors.New("output exceeds max result size")
+
+// MaxResultBytes fails any node whose Result.Data serializes to more than n
+// bytes of JSON with ErrResultTooLarge, protecting a server from marshaling
+// an accidentally huge payload into a response. Every
+// result is marshaled once to measure it, so it costs time proportional to
+// the output size. Zero disables the check.
+func (e *Engine) MaxResultBytes(n int) {
+	e.maxResultBytes = n
+}
+
+// checkResultSize enforces MaxResultBytes on every result the node produced
+func (e *Engine) checkResultSize(results map[string]Result) error {
+	for _, result := range results {
+		data, err := json.Marshal(result.Data)
+		if err != nil {
+			return fmt.Errorf("output can't be sized: %w", err)
+		}
+		if len(data) > e.maxResultBytes {
+			return ErrResultTooLarge
+		}
+	}
+	return nil
+}
+
+// checkNilData fails a node with dependents that produced a result with nil
+// Data, which every dependent's FromDeps would reject with a confusing type
+// error. Leaf nodes may return nil data.
+func (e *Engine) checkNilData(nodeID string, results map[string]Result) error {
+	hasNil := false
+	for _, result := range results {
+		if result.Data == nil {
+			hasNil = true
+		}
+	}
+	if !hasNil {
+		return nil
+	}
+
+	var dependents []string
+	for _, id := range sortedIDs(e.nodes) {
+		for _, dep := range e.nodes[id].DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok && producer == nodeID {
+				dependents = append(dependents, id)
+				break
+			}
+		}
+	}
+	if len(dependents) > 0 {
+		return fmt.Errorf("node %s produced nil data but is depended on by %v", nodeID, dependents)
+	}
+	return nil
+}
+
+// RunWhere runs only the nodes matching pred plus everything they depend on,
+// e.g. every node whose ID starts with "report". The remaining nodes are
+// skipped with the reason "not selected" and show up in Skipped.
+func (e *Engine) RunWhere(pred func(Node) bool) error {
+	selected := make(map[string]bool)
+	var visit func(id string)
+	visit = func(id string) {
+		if selected[id] {
+			return
+		}
+		selected[id] = true
+		for _, dep := range e.nodes[id].DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok {
+				visit(producer)
+			}
+		}
+	}
+	for _, id := range sortedIDs(e.nodes) {
+		if pred(e.nodes[id]) {
+			visit(id)
+		}
+	}
+
+	e.selected = selected
+	defer func() { e.selected = nil }()
+	return e.Run()
+}
+
+// checkAllStored verifies every non-fan-out node has a stored result
+func (e *Engine) checkAllStored() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, id := range sortedIDs(e.nodes) {
+		if _, skipped := e.skipped[id]; skipped || e.nodes[id].RunMulti != nil || e.nodes[id].Detached || e.collected[id] || e.timedOut[id] || e.failed[id] != nil {
+			continue
+		}
+		if _, ok := e.results[id]; !ok {
+			return fmt.Errorf("node %s completed without storing a result", id)
+		}
+	}
+	return nil
+}
+
+// lateResult reports whether the engine has stopped waiting for nodeID, so
+// its results must be dropped: BestEffort gave up on it, or the run that
+// started it already returned. Detached nodes outlive their run by design and
+// nodes run with RunNode belong to no run. The caller must hold mu.
+func (e *Engine) lateResult(ctx context.Context, nodeID string) bool {
+	if e.timedOut[nodeID] {
+		return true
+	}
+	runID, ok := RunID(ctx)
+	if !ok || e.nodes[nodeID].Detached {
+		return false
+	}
+	return e.runDone || runID != e.runID
+}
+
+// RunNode executes exactly one node using the dependency results currently held
+// by the engine, without re-running anything upstream, and stores its result.
+// It errors if a dependency's result is missing, e.g. because no full Run has
+// populated it yet. This supports tweaking a node and re-executing just it after
+// an initial run. For fan-out nodes the returned Result is the one emitted under
+// the node's own ID, if any; sub-results are available from Results.
+func (e *Engine) RunNode(id string) (Result, error) {
+	node, ok := e.nodes[id]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown node: %s", id)
+	}
+
+	e.mu.RLock()
+	var missing []string
+	for _, dep := range node.DependsOn {
+		if _, ok := e.resultFor(dep); !ok {
+			missing = append(missing, dep)
+		}
+	}
+	e.mu.RUnlock()
+	if len(missing) > 0 {
+		return Result{}, fmt.Errorf("node %s is missing dependency results: %s", id, strings.Join(missing, ", "))
+	}
+
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return Result{}, err
+	}
+	level := slices.IndexFunc(levels, func(ids []string) bool { return slices.Contains(ids, id) })
+	if err := e.runNode(context.Background(), id, max(level, 0)); err != nil {
+		return Result{}, err
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.results[id], nil
+}
+
+// runNode executes a single node against the results of its dependencies and
+// stores what it produces.
+func (e *Engine) runNode(ctx context.Context, nodeID string, level int) (err error) {
+	node := e.nodes[nodeID]
+	defer e.releaseDeps(node)
+	defer func() {
+		if err != nil && !errors.Is(err, ErrHalt) {
+			e.mu.Lock()
+			e.nodeErrors[nodeID] = err
+			e.mu.Unlock()
+		}
+	}()
+
+	// Gather dependency results (safe to read, deps already complete)
+	depResults := make(map[string]Result)
+	e.mu.RLock()
+	for _, depID := range node.DependsOn {
+		// this is storing values so we don't need to lock
+		// the result from the map. Sub-IDs a fan-out node did not
+		// emit are left out so FromDeps reports them as missing.
+		if result, ok := e.resultFor(depID); ok {
+			depResults[depID] = result
+		} else if producer, ok := producerOf(e.nodes, depID); ok && e.skippedByNode[producer] {
+			depResults[depID] = Result{ID: depID, Data: skippedData{}}
+		} else if ok && e.timedOut[producer] {
+			depResults[depID] = Result{ID: depID, Data: timedOutData{}}
+		}
+	}
+	e.mu.RUnlock()
+
+	if reason, skip := e.skipReason(node, depResults); skip {
+		e.mu.Lock()
+		e.skipped[nodeID] = reason
+		e.finished[nodeID] = true
+		e.mu.Unlock()
+		e.logf("  ↷ %s skipped (%s)\n", nodeID, reason)
+		e.emit(ctx, event{Kind: eventSkipped, Node: nodeID, Reason: reason})
+		return nil
+	}
+
+	// Nodes with a cache key reuse a cached result while it's fresh
+	var cacheKey string
+	cacheable := node.CacheKey != nil && node.CacheTTL > 0 && e.cache != nil
+	if cacheable {
+		cacheKey = node.CacheKey(depResults)
+		if cached, ok := e.cache.get(nodeID, cacheKey); ok {
+			e.mu.Lock()
+			if e.lateResult(ctx, nodeID) {
+				e.mu.Unlock()
+				return nil
+			}
+			stored := make(map[string]Result, len(cached))
+			for resultID, result := range cached {
+				result.Level = level
+				e.results[resultID] = result
+				stored[resultID] = result
+			}
+			e.finished[nodeID] = true
+			e.mu.Unlock()
+			e.logf("  ✓ %s completed (cached)\n", nodeID)
+			e.emit(ctx, event{Kind: eventCompleted, Node: nodeID, Cached: true, Results: stored})
+			return nil
+		}
+	}
+
+	// Node output goes straight to the engine output unless buffered, in
+	// which case it's flushed together with the completion line below.
+	var out io.Writer = e.out
+	var buf *bytes.Buffer
+	if e.bufferNodeOutput {
+		buf = &bytes.Buffer{}
+		out = buf
+	}
+	flush := func(line string) {
+		if buf != nil {
+			buf.WriteString(line)
+			e.out.Write(buf.Bytes())
+			return
+		}
+		io.WriteString(e.out, line)
+	}
+
+	if slots := e.groupSlots[node.ConcurrencyGroup]; slots != nil {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-ctx.Done():
+			return e.nodeError(nodeID, fmt.Errorf("waiting for group %s: %w", node.ConcurrencyGroup, ctx.Err()))
+		}
+	}
+	if limiter := e.rateLimiters[node.ConcurrencyGroup]; limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return e.nodeError(nodeID, fmt.Errorf("waiting for rate limit of group %s: %w", node.ConcurrencyGroup, err))
+		}
+	}
+
+	if e.scheduleGate != nil {
+		select {
+		case <-e.scheduleGate(nodeID):
+		case <-ctx.Done():
+			return e.nodeError(nodeID, ctx.Err())
+		}
+	}
+
+	// Execute node
+	e.emit(ctx, event{Kind: eventStarted, Node: nodeID})
+	start := time.Now()
+	results, err := e.withMiddleware(node).execute(withNode(withResources(ctx, e.resources), nodeID, out), depResults)
+	elapsed := time.Since(start)
+
+	e.mu.Lock()
+	e.durations[nodeID] = elapsed
+	e.executions = append(e.executions, Execution{ID: nodeID, Level: level, Start: start, End: start.Add(elapsed)})
+	e.mu.Unlock()
+
+	if errors.Is(err, ErrSkip) {
+		reason := "skipped by node: " + err.Error()
+		e.mu.Lock()
+		e.skipped[nodeID] = reason
+		e.skippedByNode[nodeID] = true
+		e.finished[nodeID] = true
+		e.mu.Unlock()
+		flush(e.tagged(fmt.Sprintf("  ↷ %s skipped (%s)\n", nodeID, reason)))
+		e.emit(ctx, event{Kind: eventSkipped, Node: nodeID, Reason: reason})
+		return nil
+	}
+	if errors.Is(err, ErrHalt) {
+		// A halt stops the run successfully, so it isn't reported as a failure
+		flush("")
+		e.emit(ctx, event{Kind: eventHalted, Node: nodeID, Duration: elapsed})
+		return e.nodeError(nodeID, err)
+	}
+	if err != nil {
+		flush("")
+		e.emit(ctx, event{Kind: eventError, Node: nodeID, Duration: elapsed, Err: err})
+		return e.nodeError(nodeID, err)
+	}
+	if e.maxResultBytes > 0 {
+		if err := e.checkResultSize(results); err != nil {
+			flush("")
+			e.emit(ctx, event{Kind: eventError, Node: nodeID, Duration: elapsed, Err: err})
+			return e.nodeError(nodeID, err)
+		}
+	}
+	if e.strict {
+		if err := e.checkNilData(nodeID, results); err != nil {
+			flush("")
+			e.emit(ctx, event{Kind: eventError, Node: nodeID, Duration: elapsed, Err: err})
+			return e.nodeError(nodeID, err)
+		}
+	}
+
+	e.mu.Lock()
+	if e.lateResult(ctx, nodeID) {
+		e.mu.Unlock()
+		return nil
+	}
+	for resultID, result := range results {
+		result.Level = level
+		results[resultID] = result
+		e.results[resultID] = result
+	}
+	e.finished[nodeID] = true
+	e.mu.Unlock()
+
+	if cacheable {
+		e.cache.put(nodeID, cacheKey, results, node.CacheTTL)
+	}
+
+	line := fmt.Sprintf("  ✓ %s completed", nodeID)
+	if meta := results[nodeID].Meta; len(meta) > 0 {
+		line += " (" + formatMeta(meta) + ")"
+	}
+	flush(e.tagged(line + "\n"))
+	e.emit(ctx, event{Kind: eventCompleted, Node: nodeID, Duration: elapsed, Results: results})
+	return nil
+}
+
+// logf writes an engine log line tagged with the current run ID
+func (e *Engine) logf(format string, args ...any) {
+	io.WriteString(e.out, e.tagged(fmt.Sprintf(format, args...)))
+}
+
+// tagged prefixes msg, after any leading blank lines, with the current run ID
+// so lines from concurrent runs sharing one log can be told apart.
+func (e *Engine) tagged(msg string) string {
+	e.mu.RLock()
+	runID := e.runID
+	e.mu.RUnlock()
+	if runID == "" {
+		return msg
+	}
+	text := strings.TrimLeft(msg, "\n")
+	return msg[:len(msg)-len(text)] + "[" + runID + "] " + text
+}
+
+// LastRunID returns the ID of the current or most recent run, or "" if the
+// engine hasn't run yet. Every line the engine logs during a run is prefixed
+// with it, and nodes can read it with RunID.
+func (e *Engine) LastRunID() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.runID
+}
+
+// skipReason reports whether the node should be skipped because a dependency
+// was skipped before running or a conditional dependency's predicate rejected
+// its result. Dependencies that skipped themselves with ErrSkip don't skip
+// their dependents.
+func (e *Engine) skipReason(node Node, deps map[string]Result) (string, bool) {
+	if e.selected != nil && !e.selected[node.ID] {
+		return "not selected", true
+	}
+
+	e.mu.RLock()
+	for _, dep := range node.DependsOn {
+		if producer, ok := producerOf(e.nodes, dep); ok {
+			if _, skipped := e.skipped[producer]; skipped && !e.skippedByNode[producer] {
+				e.mu.RUnlock()
+				return "dependency " + producer + " skipped", true
+			}
+			if e.failed[producer] != nil {
+				e.mu.RUnlock()
+				return "dependency " + producer + " failed", true
+			}
+		}
+	}
+	e.mu.RUnlock()
+
+	conditions := make([]string, 0, len(node.ConditionalDeps))
+	for dep := range node.ConditionalDeps {
+		conditions = append(conditions, dep)
+	}
+	sort.Strings(conditions)
+	for _, dep := range conditions {
+		if !node.ConditionalDeps[dep](deps[dep]) {
+			return "condition on " + dep + " not met", true
+		}
+	}
+	return "", false
+}
+
+// Durations returns how long each node ran in the last run. Nodes served
+// from cache, skipped or seeded have no entry.
+func (e *Engine) Durations() map[string]time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	durations := make(map[string]time.Duration, len(e.durations))
+	for id, d := range e.durations {
+		durations[id] = d
+	}
+	return durations
+}
+
+// Progress reports how many of the engine's nodes have finished (completed,
+// been skipped or been seeded) out of the total. It is safe to call from
+// another goroutine while a run is in progress, e.g. to back a "17/40
+// complete" indicator.
+func (e *Engine) Progress() (done int, total int) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	done = len(e.finished)
+	for id := range e.seeds {
+		if _, ok := e.nodes[id]; ok && !e.finished[id] {
+			done++
+		}
+	}
+	return done, len(e.nodes)
+}
+
+// Skipped returns the nodes skipped in the last run mapped to the reason. Nodes
+// that skipped themselves by returning ErrSkip have a reason starting with
+// "skipped by node"; the others were skipped before running, by a predicate,
+// a skipped dependency, RunWhere, or a failed dependency under
+// RunContinueOnError.
+func (e *Engine) Skipped() map[string]string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	skipped := make(map[string]string, len(e.skipped))
+	for id, reason := range e.skipped {
+		skipped[id] = reason
+	}
+	return skipped
+}
+
+// costOrder returns the level's node IDs with the most expensive nodes first, so
+// long-running work starts early when parallelism is limited. Ties keep ID order.
+func (e *Engine) costOrder(level []string) []string {
+	ordered := append([]string(nil), level...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return e.nodes[ordered[i]].Cost > e.nodes[ordered[j]].Cost
+	})
+	return ordered
+}
+
+// exclusiveLast moves the level's Exclusive nodes after the others, keeping
+// the relative order within each group
+func (e *Engine) exclusiveLast(level []string) []string {
+	ordered := slices.Clone(level)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return !e.nodes[ordered[i]].Exclusive && e.nodes[ordered[j]].Exclusive
+	})
+	return ordered
+}
+
+// CostDeviation compares a node's estimated Cost with how long it actually ran
+type CostDeviation struct {
+	ID        string
+	Estimated time.Duration
+	Actual    time.Duration
+}
+
+// SlowNodes returns the nodes from the last run whose actual duration exceeded
+// their Cost estimate by more than factor (e.g. 2 flags nodes that took over
+// twice as long as expected), slowest relative to the estimate first. Nodes
+// without a Cost are ignored.
+func (e *Engine) SlowNodes(factor float64) []CostDeviation {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var slow []CostDeviation
+	for id, actual := range e.durations {
+		estimated := e.nodes[id].Cost
+		if estimated <= 0 || float64(actual) <= float64(estimated)*factor {
+			continue
+		}
+		slow = append(slow, CostDeviation{ID: id, Estimated: estimated, Actual: actual})
+	}
+	sort.Slice(slow, func(i, j int) bool {
+		ri := float64(slow[i].Actual) / float64(slow[i].Estimated)
+		rj := float64(slow[j].Actual) / float64(slow[j].Estimated)
+		if ri != rj {
+			return ri > rj
+		}
+		return slow[i].ID < slow[j].ID
+	})
+	return slow
+}
+
+// Reset clears the results and timings of previous runs so the engine can be
+// run again from scratch.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.results = make(map[string]Result)
+	e.durations = make(map[string]time.Duration)
+	e.skipped = make(map[string]string)
+	e.skippedByNode = make(map[string]bool)
+	e.timedOut = make(map[string]bool)
+	e.finished = make(map[string]bool)
+	e.detachedErrs = nil
+	e.executions = nil
+	e.failed = make(map[string]error)
+	e.nodeErrors = make(map[string]error)
+	e.runEnd = time.Time{}
+	e.runErr = nil
+	e.runDone = false
+	for id, result := range e.seeds {
+		e.results[id] = result
+	}
+}
+
+// Seed pre-populates results before a run, e.g. with a value computed
+// elsewhere or a fixed config value. A seeded node is treated as already
+// complete and is not run, even if it has a Run func; dependents receive the
+// seeded result instead. IDs that aren't nodes in the engine are allowed and
+// satisfy dependencies on them, enabling partial-graph execution with
+// externally supplied inputs. Seeds are kept across Reset.
+func (e *Engine) Seed(results ...Result) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.seeds == nil {
+		e.seeds = make(map[string]Result)
+	}
+	for _, result := range results {
+		e.seeds[result.ID] = result
+		e.results[result.ID] = result
+	}
+}
+
+// VerifyIdempotent runs the graph twice from scratch and fails if any node
+// produced different Data the second time. It is a CI/developer check for
+// pipelines that are supposed to be deterministic, not a production path.
+// Nodes marked NonDeterministic are not compared. The engine keeps the results
+// of the second run.
+func (e *Engine) VerifyIdempotent() error {
+	e.Reset()
+	if err := e.Run(); err != nil {
+		return fmt.Errorf("first run: %w", err)
+	}
+	first := e.Results()
+
+	e.Reset()
+	if err := e.Run(); err != nil {
+		return fmt.Errorf("second run: %w", err)
+	}
+	second := e.Results()
+
+	var differing []string
+	for id := range mergeKeys(first, second) {
+		if producer, ok := producerOf(e.nodes, id); ok && e.nodes[producer].NonDeterministic {
+			continue
+		}
+		a, inFirst := first[id]
+		b, inSecond := second[id]
+		if inFirst != inSecond || !reflect.DeepEqual(a.Data, b.Data) {
+			differing = append(differing, id)
+		}
+	}
+	if len(differing) > 0 {
+		sort.Strings(differing)
+		return fmt.Errorf("graph is not idempotent, results differ between runs: %s", strings.Join(differing, ", "))
+	}
+	return nil
+}
+
+// mergeKeys returns the union of the keys of two result maps
+func mergeKeys(a, b map[string]Result) map[string]bool {
+	keys := make(map[string]bool, len(a))
+	for id := range a {
+		keys[id] = true
+	}
+	for id := range b {
+		keys[id] = true
+	}
+	return keys
+}
+
+// Results returns a copy of all collected results after execution
+func (e *Engine) Results() map[string]Result {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return maps.Clone(e.results)
+}
+
+// Orphans returns the nodes that are neither a requested target nor depended on
+// by any other node in the engine. Every node in an engine produced by BuildFor
+// should be reachable from a target, so a non-empty result points at a
+// resolution bug or an over-broad build. Engines built with New have no targets,
+// so their leaf nodes are all reported.
+func (e *Engine) Orphans() []string {
+	required := make(map[string]bool)
+	for _, id := range e.targets {
+		if producer, ok := producerOf(e.nodes, id); ok {
+			required[producer] = true
+		}
+	}
+	for _, node := range e.nodes {
+		for _, dep := range node.DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok {
+				required[producer] = true
+			}
+		}
+	}
+
+	var orphans []string
+	for id := range e.nodes {
+		if !required[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// Builder constructs engines from a node catalog with automatic dependency resolution.
+//
+// Concurrency: once configured, a Builder is safe for concurrent BuildFor calls
+// (e.g. from every HTTP handler of a server). NewBuilder copies the catalog, so
+// nodes registered afterwards are not seen and can't race with builds, and each
+// BuildFor returns a fresh Engine that is not shared with other callers.
+// Configuration methods such as WarnUnused must be called before the builder
+// is shared.
+type Builder struct {
+	catalog map[string]Node
+
+	// opts are applied to every engine the builder creates
+	opts []Option
+
+	// templates memoizes BuildForCached by target set
+	mu        sync.Mutex
+	templates map[string]*template
+
+	// warnUnused logs the catalog nodes a build leaves out
+	warnUnused bool
+
+	// enabled reports whether a catalog node may be built; nil enables all
+	enabled func(id string) bool
+
+	// strict lints the target list of every build
+	strict bool
+}
+
+// NewBuilder creates a builder from a snapshot of a node catalog. The options
+// are applied to every engine BuildFor creates.
+func NewBuilder(catalog map[string]Node, opts ...Option) *Builder {
+	snapshot := make(map[string]Node, len(catalog))
+	for id, node := range catalog {
+		snapshot[id] = node.normalize()
+	}
+	return &Builder{catalog: snapshot, opts: opts}
+}
+
+// BuildFor creates an engine with the specified target nodes and ALL their transitive dependencies.
+// Just specify the terminal nodes you need - dependencies are resolved automatically.
+func (b *Builder) BuildFor(targetNodeIDs ...string) (*Engine, error) {
+	if err := b.checkTargets(targetNodeIDs); err != nil {
+		return nil, err
+	}
+	needed, err := b.resolve(targetNodeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.warnUnused {
+		if unused := b.unused(needed); len(unused) > 0 {
+			log.Printf("warning: registered nodes contribute nothing to targets [%s]: %s",
+				strings.Join(targetNodeIDs, ", "), strings.Join(unused, ", "))
+		}
+	}
+
+	e := New(needed, b.opts...)
+	e.targets = append([]string(nil), targetNodeIDs...)
+	return e, nil
+}
+
+// template is a resolved and planned subgraph reused by BuildForCached
+type template struct {
+	nodes  map[string]Node
+	levels [][]string
+}
+
+// BuildForCached is BuildFor for hot paths that build the same subgraph over
+// and over, e.g. a server endpoint with fixed targets. The first call for a set
+// of targets resolves and validates the subgraph and computes its levels; later
+// calls reuse that template and only create a fresh engine around it. Templates
+// are kept for the life of the builder, so don't use it with unbounded target
+// sets such as ones taken from user input.
+func (b *Builder) BuildForCached(targetNodeIDs ...string) (*Engine, error) {
+	if err := b.checkTargets(targetNodeIDs); err != nil {
+		return nil, err
+	}
+	key := slices.Clone(targetNodeIDs)
+	sort.Strings(key)
+	cacheKey := strings.Join(slices.Compact(key), "\x00")
+
+	b.mu.Lock()
+	t, ok := b.templates[cacheKey]
+	b.mu.Unlock()
+
+	if !ok {
+		needed, err := b.resolve(targetNodeIDs)
+		if err != nil {
+			return nil, err
+		}
+		levels, err := New(needed).topoSortLevels()
+		if err != nil {
+			return nil, err
+		}
+		t = &template{nodes: needed, levels: levels}
+
+		b.mu.Lock()
+		if b.templates == nil {
+			b.templates = make(map[string]*template)
+		}
+		b.templates[cacheKey] = t
+		b.mu.Unlock()
+	}
+
+	e := New(t.nodes, b.opts...)
+	e.targets = slices.Clone(targetNodeIDs)
+	e.plan = t.levels
+	return e, nil
+}
+
+// SetEnabled gates which catalog nodes BuildFor may use, e.g. with
+// catalog.Enabled to feature-flag experimental nodes off in production.
+// Requesting a disabled target, or a target that needs a disabled node, is an
+// error, except that a disabled optional dependency (Node.OptionalDeps) is
+// dropped from its dependent. The gate is consulted at build time, so
+// templates of BuildForCached keep the decision of their first build.
+func (b *Builder) SetEnabled(enabled func(id string) bool) {
+	b.enabled = enabled
+}
+
+// Strict makes BuildFor and BuildForCached lint the caller's target list: a
+// target listed twice, or one that another target already depends on (e.g.
+// node3,node2a where node3 needs node2a), is an error. Either usually means
+// the caller's selection logic is off. It returns the builder for chaining.
+func (b *Builder) Strict() *Builder {
+	b.strict = true
+	return b
+}
+
+// checkTargets rejects duplicate and redundant targets when the builder is strict
+func (b *Builder) checkTargets(targetNodeIDs []string) error {
+	if !b.strict {
+		return nil
+	}
+
+	producers := make(map[string]string, len(targetNodeIDs))
+	for _, id := range targetNodeIDs {
+		producer, ok := producerOf(b.catalog, id)
+		if !ok {
+			return fmt.Errorf("unknown node: %s", id)
+		}
+		if prev, dup := producers[producer]; dup {
+			if prev == id {
+				return fmt.Errorf("duplicate target: %s", id)
+			}
+			return fmt.Errorf("duplicate target: %s and %s are the same node", prev, id)
+		}
+		producers[producer] = id
+	}
+
+	for _, id := range targetNodeIDs {
+		needed, err := b.resolve([]string{id})
+		if err != nil {
+			return err
+		}
+		for _, other := range targetNodeIDs {
+			if other == id {
+				continue
+			}
+			producer, _ := producerOf(b.catalog, other)
+			if _, ok := needed[producer]; ok {
+				return fmt.Errorf("redundant target: %s is already a dependency of %s", other, id)
+			}
+		}
+	}
+	return nil
+}
+
+// WarnUnused makes BuildFor log a warning listing every catalog node that the
+// requested targets don't need. Enable it when building for the full set of
+// targets you care about to find node packages that are still imported in
+// nodes.go but no longer used.
+func (b *Builder) WarnUnused(enabled bool) {
+	b.warnUnused = enabled
+}
+
+// Unused returns the catalog nodes that contribute nothing to the given targets,
+// i.e. nodes that are neither a target nor a transitive dependency of one.
+func (b *Builder) Unused(targetNodeIDs ...string) ([]string, error) {
+	needed, err := b.resolve(targetNodeIDs)
+	if err != nil {
+		return nil, err
+	}
+	return b.unused(needed), nil
+}
+
+// unused returns the sorted catalog IDs missing from the resolved node set
+func (b *Builder) unused(needed map[string]Node) []string {
+	var unused []string
+	for id := range b.catalog {
+		if _, ok := needed[id]; !ok {
+			unused = append(unused, id)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// Leaves returns the sorted IDs of the enabled catalog nodes nothing depends
+// on, the targets that build the whole graph. Unlike Leaves on the raw
+// catalog it sees the edges as re-wired by LoadDefinition.
+func (b *Builder) Leaves() []string {
+	return slices.DeleteFunc(Leaves(b.catalog), func(id string) bool { return !b.isEnabled(id) })
+}
+
+// ExplainInclusion answers "why is this node in my build?": it returns a
+// shortest dependency path from target to node as BuildFor(target) would
+// resolve it, e.g. [node3 node2a node1]. It errors if BuildFor(target) would
+// not include node.
+func (b *Builder) ExplainInclusion(target string, node string) ([]string, error) {
+	needed, err := b.resolve([]string{target})
+	if err != nil {
+		return nil, err
+	}
+	from, _ := producerOf(b.catalog, target)
+	to, ok := producerOf(b.catalog, node)
+	if !ok {
+		return nil, fmt.Errorf("unknown node: %s", node)
+	}
+
+	// Breadth-first over the resolved subgraph, visiting dependencies in
+	// sorted order so the same path is reported every time
+	parent := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == to {
+			var path []string
+			for ; id != ""; id = parent[id] {
+				path = append(path, id)
+			}
+			slices.Reverse(path)
+			return path, nil
+		}
+		for _, dep := range sortedDeps(needed[id]) {
+			producer, _ := producerOf(needed, dep)
+			if _, seen := parent[producer]; !seen {
+				parent[producer] = id
+				queue = append(queue, producer)
+			}
+		}
+	}
+	return nil, fmt.Errorf("node %s is not included in a build for %s", node, target)
+}
+
+func (b *Builder) isEnabled(id string) bool {
+	return b.enabled == nil || b.enabled(id)
+}
+
+// resolve returns the target nodes and all of their transitive dependencies
+func (b *Builder) resolve(targetNodeIDs []string) (map[string]Node, error) {
+	needed := make(map[string]Node)
+
+	var resolve func(id string) error
+	resolve = func(id string) error {
+		producer, ok := producerOf(b.catalog, id)
+		if !ok {
+			return fmt.Errorf("unknown node: %s", id)
+		}
+		if _, already := needed[producer]; already {
+			return nil
+		}
+
+		node := b.catalog[producer]
+		var deps []string
+		for _, dep := range node.DependsOn {
+			if depProducer, ok := producerOf(b.catalog, dep); ok && !b.isEnabled(depProducer) {
+				if !slices.Contains(node.OptionalDeps, dep) {
+					return fmt.Errorf("node %s depends on disabled node %s", producer, depProducer)
+				}
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		node.DependsOn = deps
+		needed[producer] = node
+
+		for _, dep := range node.DependsOn {
+			if err := resolve(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, id := range targetNodeIDs {
+		if producer, ok := producerOf(b.catalog, id); ok && !b.isEnabled(producer) {
+			return nil, fmt.Errorf("node %s is disabled", producer)
+		}
+		if err := resolve(id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkVersions(needed); err != nil {
+		return nil, err
+	}
+	return needed, nil
+}
+
+// Levels returns the node IDs grouped into execution levels. Nodes in the same
+// level run in parallel and each level is sorted by ID.
+func (e *Engine) Levels() ([][]string, error) {
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkWriteConflicts(levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// TopoOrder returns every node ID in one flat, valid execution order: the
+// levels concatenated, sorted by ID within each level. Use it to drive a
+// strictly sequential consumer or to print a build order.
+func (e *Engine) TopoOrder() ([]string, error) {
+	levels, err := e.Levels()
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	for _, level := range levels {
+		order = append(order, level...)
+	}
+	return order, nil
+}
+
+// Walk visits every node in topological order, level by level and by ID within a
+// level, calling fn with the node's execution level as depth. It stops at and
+// returns the first error fn returns. Walk is a building block for custom
+// exporters, validators and transformations that shouldn't re-implement the sort.
+func (e *Engine) Walk(fn func(id string, node Node, depth int) error) error {
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return err
+	}
+	for depth, level := range levels {
+		for _, id := range level {
+			if err := fn(id, e.nodes[id], depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// topoSortLevels returns nodes grouped into levels.
+// Nodes in the same level have no dependencies on each other and can run in parallel.
+// Each level is sorted by node ID so the result is deterministic across runs.
+func (e *Engine) topoSortLevels() ([][]string, error) {
+	if e.plan != nil && len(e.seeds) == 0 {
+		levels := make([][]string, len(e.plan))
+		for i, level := range e.plan {
+			levels[i] = slices.Clone(level)
+		}
+		return levels, nil
+	}
+	if err := checkVersions(e.nodes); err != nil {
+		return nil, err
+	}
+	if err := checkDetached(e.nodes); err != nil {
+		return nil, err
+	}
+
+	// Build in-degree map. Seeded nodes are already complete, so they are
+	// left out of the levels and edges to them are satisfied up front.
+	inDegree := make(map[string]int)
+	for id := range e.nodes {
+		if _, seeded := e.seeds[id]; !seeded {
+			inDegree[id] = 0
+		}
+	}
+	// Build reverse adjacency (who depends on me). Several sub-IDs of the
+	// same fan-out node collapse into a single edge.
+	dependents := make(map[string][]string)
+	for _, node := range e.nodes {
+		if _, seeded := e.seeds[node.ID]; seeded {
+			continue
+		}
+		producers := make(map[string]bool)
+		for _, dep := range node.DependsOn {
+			if _, seeded := e.seeds[dep]; seeded {
+				continue
+			}
+			producer, exists := producerOf(e.nodes, dep)
+			if !exists {
+				return nil, fmt.Errorf("node %s depends on unknown node %s", node.ID, dep)
+			}
+			if !producers[producer] {
+				producers[producer] = true
+				dependents[producer] = append(dependents[producer], node.ID)
+			}
+		}
+		for dep := range node.ConditionalDeps {
+			if !slices.Contains(node.DependsOn, dep) {
+				return nil, fmt.Errorf("node %s has a condition on %s which is not in DependsOn", node.ID, dep)
+			}
+		}
+		for producer := range e.afterOf(node) {
+			if _, seeded := e.seeds[producer]; !seeded && !producers[producer] {
+				producers[producer] = true
+				dependents[producer] = append(dependents[producer], node.ID)
+			}
+		}
+		inDegree[node.ID] = len(producers)
+	}
+
+	// Find nodes with no dependencies (first level)
+	var currentLevel []string
+	for id, degree := range inDegree {
+		if degree == 0 {
+			currentLevel = append(currentLevel, id)
+		}
+	}
+
+	// Process level by level
+	var levels [][]string
+	processed := 0
+
+	for len(currentLevel) > 0 {
+		// Sort within the level so every caller sees a stable order
+		sort.Strings(currentLevel)
+		levels = append(levels, currentLevel)
+		processed += len(currentLevel)
+
+		var nextLevel []string
+		for _, id := range currentLevel {
+			for _, dependent := range dependents[id] {
+				inDegree[dependent]--
+				if inDegree[dependent] == 0 {
+					nextLevel = append(nextLevel, dependent)
+				}
+			}
+		}
+		currentLevel = nextLevel
+	}
+
+	if processed != len(inDegree) {
+		return nil, fmt.Errorf("cycle detected in dependency graph")
+	}
+
+	return levels, nil
+}
@@ -0,0 +1,3176 @@
+package engine_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grindlemire/graph-builder/engine"
+	"github.com/grindlemire/graph-builder/engine/enginetest"
+)
+
+// constNode returns a node that produces data and ignores its dependencies
+func constNode(id string, data any, deps ...string) engine.Node {
+	return engine.Node{
+		ID:        id,
+		DependsOn: deps,
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{ID: id, Data: data}, nil
+		},
+	}
+}
+
+// diamond returns a -> (b, c) -> d
+func diamond() map[string]engine.Node {
+	return map[string]engine.Node{
+		"a": constNode("a", 1),
+		"b": constNode("b", 2, "a"),
+		"c": constNode("c", 3, "a"),
+		"d": constNode("d", 4, "b", "c"),
+	}
+}
+
+func TestLevels(t *testing.T) {
+	enginetest.AssertLevels(t, engine.New(diamond()), [][]string{{"a"}, {"b", "c"}, {"d"}})
+}
+
+func TestTopoOrder(t *testing.T) {
+	order, err := engine.New(diamond()).TopoOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("TopoOrder() = %v, want %v", order, want)
+	}
+}
+
+func TestRunMulti(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"record": {
+			ID: "record",
+			RunMulti: func(ctx context.Context, _ map[string]engine.Result) ([]engine.Result, error) {
+				return []engine.Result{{ID: "record/0", Data: "x"}, {ID: "record/1", Data: "y"}}, nil
+			},
+		},
+		"consumer": {
+			ID:        "consumer",
+			DependsOn: []string{"record/1"},
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				v, err := engine.Require[string](ctx, deps, "record/1")
+				return engine.Result{ID: "consumer", Data: v + "!"}, err
+			},
+		},
+	}
+
+	results, err := enginetest.RunAndCollect(engine.New(nodes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := results["consumer"].Data; got != "y!" {
+		t.Errorf("consumer = %v, want y!", got)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		// A halt stops the run after b's level; a skip only marks b skipped
+		// and d still runs
+		bSkipped, dRuns bool
+	}{
+		{"halt", fmt.Errorf("nothing to do: %w", engine.ErrHalt), false, false},
+		{"skip", fmt.Errorf("nothing to do: %w", engine.ErrSkip), true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes := diamond()
+			nodes["b"] = engine.Node{
+				ID:        "b",
+				DependsOn: []string{"a"},
+				Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+					return engine.Result{}, tc.err
+				},
+			}
+			nodes["d"] = engine.Node{
+				ID:        "d",
+				DependsOn: []string{"b", "c"},
+				Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+					return engine.Result{ID: "d", Data: 4}, nil
+				},
+			}
+
+			var failures atomic.Int64
+			e := engine.New(nodes)
+			e.OnNodeError(func(string, error, time.Duration) { failures.Add(1) })
+			results, err := enginetest.RunAndCollect(e)
+			if err != nil {
+				t.Fatalf("Run() = %v, want success", err)
+			}
+			if n := failures.Load(); n != 0 {
+				t.Errorf("%d node failures, want none", n)
+			}
+			if _, ok := results["c"]; !ok {
+				t.Error("sibling c should still complete")
+			}
+			if _, ok := results["d"]; ok != tc.dRuns {
+				t.Errorf("d ran = %v, want %v", ok, tc.dRuns)
+			}
+			if _, ok := e.Skipped()["b"]; ok != tc.bSkipped {
+				t.Errorf("b skipped = %v, want %v", ok, tc.bSkipped)
+			}
+		})
+	}
+}
+
+func TestRequireTypeMismatch(t *testing.T) {
+	deps := enginetest.FakeDeps(engine.Result{ID: "a", Data: 1})
+	_, err := engine.Require[string](context.Background(), deps, "a")
+	if err == nil || err.Error() != "invalid data type for a: expected string, got int" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := engine.Require[int](ctx, deps, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := diamond()
+	updated := diamond()
+	delete(updated, "c")
+	updated["d"] = constNode("d", 4, "b", "e")
+	updated["e"] = constNode("e", 5, "a")
+
+	want := "+ e (depends on: a)\n" +
+		"- c (depends on: a)\n" +
+		"~ d depends on: b, c → b, e\n"
+	if got := engine.Diff(old, updated).String(); got != want {
+		t.Errorf("diff mismatch\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if d := engine.Diff(old, diamond()); !d.Empty() {
+		t.Errorf("expected empty diff, got:\n%s", d)
+	}
+}
+
+func TestHash(t *testing.T) {
+	reordered := diamond()
+	d := reordered["d"]
+	d.DependsOn = []string{"c", "b"}
+	reordered["d"] = d
+
+	base := engine.New(diamond()).Hash()
+	if got := engine.New(reordered).Hash(); got != base {
+		t.Errorf("hash changed with dependency order: %s != %s", got, base)
+	}
+
+	changed := diamond()
+	changed["d"] = constNode("d", 4, "b")
+	if engine.New(changed).Hash() == base {
+		t.Error("hash didn't change when an edge was removed")
+	}
+}
+
+func TestRunWithDeadline(t *testing.T) {
+	nodes := diamond()
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			<-ctx.Done()
+			return engine.Result{}, ctx.Err()
+		},
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	err := e.RunWithDeadline(20 * time.Millisecond)
+
+	var interrupted *engine.InterruptError
+	if !errors.As(err, &interrupted) || interrupted.Level != 1 {
+		t.Fatalf("expected interrupt during level 1, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRunWithDeadlineDropsLateResults(t *testing.T) {
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	nodes := diamond()
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(context.Context, map[string]engine.Result) (engine.Result, error) {
+			// Ignores its context, so the run abandons it
+			defer close(returned)
+			<-release
+			return engine.Result{ID: "c", Data: "late"}, nil
+		},
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.RunWithDeadline(20 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	results := e.Results()
+	close(release)
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := e.Results()["c"]; ok {
+		t.Error("abandoned node c stored its result after the run returned")
+	}
+	if _, ok := results["a"]; !ok {
+		t.Error("expected the result of a from before the deadline")
+	}
+}
+
+func TestSpecRoundTrip(t *testing.T) {
+	data, err := engine.New(diamond()).GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := engine.FromSpec(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b", "c"}, {"d"}})
+
+	again, err := e.GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("spec did not round-trip\nfirst:\n%s\nsecond:\n%s", data, again)
+	}
+
+	if _, err := engine.FromSpec(strings.NewReader(`{"nodes":[{"id":"a","depends_on":["missing"]}]}`)); err == nil {
+		t.Error("expected unknown dependency to fail")
+	}
+}
+
+func TestSpecRoundTripRunMulti(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"record": {
+			ID: "record",
+			RunMulti: func(ctx context.Context, _ map[string]engine.Result) ([]engine.Result, error) {
+				return []engine.Result{{ID: "record/0"}, {ID: "record/1"}}, nil
+			},
+		},
+		"consumer": constNode("consumer", 1, "record/0", "record/1"),
+	}
+	data, err := engine.New(nodes).GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := engine.FromSpec(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []engine.EdgeSpec{{From: "record", To: "consumer"}}; !reflect.DeepEqual(e.Spec().Edges, want) {
+		t.Errorf("edges = %v, want %v", e.Spec().Edges, want)
+	}
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatalf("running the imported fan-out graph: %v", err)
+	}
+
+	again, err := e.GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("spec did not round-trip\nfirst:\n%s\nsecond:\n%s", data, again)
+	}
+}
+
+func TestSpecRoundTripAfter(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"clear": constNode("clear", 1),
+		"warm":  {ID: "warm", After: []string{"clear"}},
+	}
+	data, err := engine.New(nodes).GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := engine.FromSpec(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"clear"}, {"warm"}})
+	if want := []engine.EdgeSpec{{From: "clear", To: "warm", Kind: engine.EdgeAfter}}; !reflect.DeepEqual(e.Spec().Edges, want) {
+		t.Errorf("edges = %v, want %v", e.Spec().Edges, want)
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := `  "clear" -> "warm" [style=dashed];` + "\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("WriteDOT() is missing %q:\n%s", want, buf.String())
+	}
+}
+
+func TestSpecRoundTripVersions(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"a": {ID: "a", Version: "2"},
+		"b": constNode("b", 1, "a@>=2"),
+	}
+	data, err := engine.New(nodes).GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := engine.FromSpec(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := e.GraphJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("spec did not round-trip\nfirst:\n%s\nsecond:\n%s", data, again)
+	}
+	b := e.Spec().Nodes[1]
+	if want := map[string]string{"a": ">=2"}; !reflect.DeepEqual(b.Requires, want) || !reflect.DeepEqual(b.DependsOn, []string{"a"}) {
+		t.Errorf("spec of b = %+v, want a required at >=2", b)
+	}
+
+	newer := strings.Replace(string(data), `"version": "2"`, `"version": "1"`, 1)
+	if _, err := engine.FromSpec(strings.NewReader(newer)); err == nil || !strings.Contains(err.Error(), "requires a@>=2 but a is version 1") {
+		t.Errorf("FromSpec() = %v, want the unsatisfied constraint reported", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := 0
+	nodes := map[string]engine.Node{
+		"fetch": {
+			ID:       "fetch",
+			CacheKey: func(map[string]engine.Result) string { return "k" },
+			CacheTTL: time.Minute,
+			Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+				calls++
+				return engine.Result{ID: "fetch", Data: calls}, nil
+			},
+		},
+	}
+
+	cache := engine.NewResultCache()
+	for range 2 {
+		e := engine.New(nodes)
+		e.SetCache(cache)
+		if _, err := enginetest.RunAndCollect(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected cached result to be reused, run called %d times", calls)
+	}
+
+	cache.Invalidate("fetch")
+	e := engine.New(nodes)
+	e.SetCache(cache)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected invalidated node to run again, run called %d times", calls)
+	}
+}
+
+func TestConditionalDeps(t *testing.T) {
+	nodes := diamond()
+	b := nodes["b"]
+	b.ConditionalDeps = map[string]func(engine.Result) bool{
+		"a": func(r engine.Result) bool { return r.Data != 1 },
+	}
+	nodes["b"] = b
+
+	e := engine.New(nodes)
+	e.SetStrict(true)
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := results["c"]; !ok {
+		t.Error("c is unconditional and should run")
+	}
+	want := map[string]string{"b": "condition on a not met", "d": "dependency b skipped"}
+	if got := e.Skipped(); !reflect.DeepEqual(got, want) {
+		t.Errorf("skipped = %v, want %v", got, want)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	nodes := diamond()
+	delete(nodes, "a")
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("seeded node should not run")
+		},
+	}
+
+	e := engine.New(nodes)
+	e.Seed(engine.Result{ID: "a", Data: "external"}, engine.Result{ID: "b", Data: "seeded"})
+	enginetest.AssertLevels(t, e, [][]string{{"c"}, {"d"}})
+
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["b"].Data != "seeded" || results["d"].Data != 4 {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestResultGC(t *testing.T) {
+	e := engine.New(diamond())
+	e.EnableResultGC()
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results["d"].Data != 4 {
+		t.Errorf("expected only the leaf result to be kept, got %v", results)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	nodes := diamond()
+	a := nodes["a"]
+	a.Aliases = []string{"old-a"}
+	nodes["a"] = a
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"old-a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			v, err := engine.Require[int](ctx, deps, "old-a")
+			return engine.Result{ID: "c", Data: v + 10}, err
+		},
+	}
+
+	e, err := engine.NewBuilder(nodes).BuildFor("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b", "c"}, {"d"}})
+
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["c"].Data != 11 {
+		t.Errorf("c = %v, want 11", results["c"].Data)
+	}
+
+	want := []engine.AliasUsage{{Node: "c", Alias: "old-a", Canonical: "a"}}
+	if got := e.AliasUsages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("alias usages = %v, want %v", got, want)
+	}
+}
+
+type scaleNode struct {
+	factor int
+}
+
+func (n scaleNode) ID() string          { return "scaled" }
+func (n scaleNode) DependsOn() []string { return []string{"a"} }
+func (n scaleNode) Run(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+	v, err := engine.Require[int](ctx, deps, "a")
+	return engine.Result{ID: n.ID(), Data: v * n.factor}, err
+}
+
+func TestRunnable(t *testing.T) {
+	nodes := diamond()
+	nodes["scaled"] = engine.NodeFrom(scaleNode{factor: 3})
+
+	e, err := engine.NewBuilder(nodes).BuildFor("scaled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["scaled"].Data != 3 {
+		t.Errorf("scaled = %v, want 3", results["scaled"].Data)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	nodes := diamond()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	nodes["d"] = engine.Node{
+		ID:        "d",
+		DependsOn: []string{"b", "c"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			started <- struct{}{}
+			<-release
+			return engine.Result{ID: "d"}, nil
+		},
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	// The second run starts from zero rather than the first run's 4/4
+	for run := 1; run <= 2; run++ {
+		errCh := make(chan error, 1)
+		go func() { errCh <- e.Run() }()
+
+		<-started
+		if done, total := e.Progress(); done != 3 || total != 4 {
+			t.Errorf("run %d: mid-run progress = %d/%d, want 3/4", run, done, total)
+		}
+		release <- struct{}{}
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+		if done, total := e.Progress(); done != 4 || total != 4 {
+			t.Errorf("run %d: final progress = %d/%d, want 4/4", run, done, total)
+		}
+	}
+}
+
+func TestRunID(t *testing.T) {
+	e := engine.New(diamond())
+	var out bytes.Buffer
+	e.SetOutput(&out)
+	if id := e.LastRunID(); id != "" {
+		t.Fatalf("run ID before run = %q, want empty", id)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	first := e.LastRunID()
+	if len(first) != 36 {
+		t.Errorf("run ID %q is not a UUID", first)
+	}
+	if !strings.Contains(out.String(), "["+first+"]   ✓ d completed") {
+		t.Errorf("output lines aren't tagged with the run ID:\n%s", out.String())
+	}
+
+	e.Reset()
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if e.LastRunID() == first {
+		t.Error("second run reused the first run's ID")
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	exclusiveAlone := true
+	track := func(id string, exclusive bool) engine.Node {
+		return engine.Node{
+			ID:        id,
+			DependsOn: []string{"a"},
+			Exclusive: exclusive,
+			Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				if exclusive && running > 1 {
+					exclusiveAlone = false
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				if exclusive && running > 1 {
+					exclusiveAlone = false
+				}
+				running--
+				mu.Unlock()
+				return engine.Result{ID: id}, nil
+			},
+		}
+	}
+
+	nodes := map[string]engine.Node{"a": constNode("a", 1)}
+	for _, id := range []string{"b", "c", "d"} {
+		nodes[id] = track(id, false)
+	}
+	nodes["x"] = track("x", true)
+
+	e := engine.New(nodes)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if !exclusiveAlone {
+		t.Error("exclusive node ran alongside another node")
+	}
+	if maxRunning < 2 {
+		t.Error("non-exclusive nodes in the level didn't run in parallel")
+	}
+}
+
+func TestDetectWriteConflicts(t *testing.T) {
+	nodes := diamond()
+	b, c := nodes["b"], nodes["c"]
+	b.Writes = []string{"cache"}
+	c.Writes = []string{"cache", "db"}
+	nodes["b"], nodes["c"] = b, c
+
+	e := engine.New(nodes)
+	if err := e.Validate(); err != nil {
+		t.Fatalf("conflicts reported without DetectWriteConflicts: %v", err)
+	}
+
+	e.DetectWriteConflicts()
+	err := e.Validate()
+	if err == nil || !strings.Contains(err.Error(), "level 1: b, c all write cache") {
+		t.Fatalf("Validate() = %v, want conflict on cache", err)
+	}
+	if err := e.Run(); err == nil {
+		t.Error("Run() succeeded despite write conflicts")
+	}
+}
+
+func TestRunWhere(t *testing.T) {
+	nodes := diamond()
+	nodes["report-b"] = constNode("report-b", "r", "b")
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	err := e.RunWhere(func(n engine.Node) bool { return strings.HasPrefix(n.ID, "report") })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := e.Results()
+	for _, id := range []string{"a", "b", "report-b"} {
+		if _, ok := results[id]; !ok {
+			t.Errorf("%s didn't run", id)
+		}
+	}
+	want := map[string]string{"c": "not selected", "d": "not selected"}
+	if got := e.Skipped(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Skipped() = %v, want %v", got, want)
+	}
+}
+
+func TestJSONLogs(t *testing.T) {
+	nodes := diamond()
+	nodes["d"] = engine.Node{
+		ID:        "d",
+		DependsOn: []string{"b", "c"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+
+	var logs bytes.Buffer
+	e := engine.New(nodes).WithJSONLogs(&logs)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err == nil {
+		t.Fatal("Run() succeeded, want d's error")
+	}
+
+	counts := make(map[string]int)
+	dec := json.NewDecoder(&logs)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		if line["run_id"] != e.LastRunID() {
+			t.Errorf("event %v doesn't carry the run ID", line)
+		}
+		counts[line["event"].(string)]++
+		if line["event"] == "error" && (line["node"] != "d" || line["error"] != "boom") {
+			t.Errorf("error event = %v", line)
+		}
+	}
+	want := map[string]int{"level_started": 3, "level_completed": 3, "started": 4, "completed": 3, "error": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("event counts = %v, want %v", counts, want)
+	}
+}
+
+func TestJSONLogsHalt(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, engine.ErrHalt
+		},
+	}
+
+	var logs bytes.Buffer
+	e := engine.New(nodes).WithJSONLogs(&logs)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(&logs)
+	var halted bool
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case line["event"] == "error":
+			t.Errorf("halt logged as an error: %v", line)
+		case line["event"] == "halted":
+			halted = line["node"] == "b"
+		}
+	}
+	if !halted {
+		t.Errorf("no halted event for b in %s", logs.String())
+	}
+}
+
+type fakeDB struct{ name string }
+
+func TestResource(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"query": {ID: "query", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			db, err := engine.Resource[*fakeDB](ctx, "db")
+			if err != nil {
+				return engine.Result{}, err
+			}
+			return engine.Result{ID: "query", Data: db.name}, nil
+		}},
+	}
+
+	e := engine.New(nodes, engine.WithResource("db", &fakeDB{name: "test"}))
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["query"].Data != "test" {
+		t.Errorf("query = %v, want test", results["query"].Data)
+	}
+
+	_, err = enginetest.RunAndCollect(engine.New(nodes))
+	if err == nil || !strings.Contains(err.Error(), "node query: resource db not provided") {
+		t.Errorf("missing resource error = %v", err)
+	}
+}
+
+func TestBuildForCached(t *testing.T) {
+	builder := engine.NewBuilder(diamond())
+	first, err := builder.BuildForCached("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := builder.BuildForCached("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, second, [][]string{{"a"}, {"b", "c"}, {"d"}})
+
+	// Engines built from one template don't share results or levels
+	if _, err := enginetest.RunAndCollect(first); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(second.Results()); got != 0 {
+		t.Errorf("second engine has %d results before running", got)
+	}
+	levels, _ := first.Levels()
+	levels[0][0] = "mutated"
+	enginetest.AssertLevels(t, second, [][]string{{"a"}, {"b", "c"}, {"d"}})
+
+	if _, err := builder.BuildForCached("missing"); err == nil {
+		t.Error("BuildForCached accepted an unknown target")
+	}
+}
+
+func TestInputs(t *testing.T) {
+	nodes := diamond()
+	nodes["sum"] = engine.Node{
+		ID:     "sum",
+		Inputs: []engine.InputSpec{engine.Input[int]("b"), engine.Input[int]("c")},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{ID: "sum", Data: engine.Value[int](deps, "b") + engine.Value[int](deps, "c")}, nil
+		},
+	}
+
+	e, err := engine.NewBuilder(nodes).BuildFor("sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b", "c"}, {"sum"}})
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["sum"].Data != 5 {
+		t.Errorf("sum = %v, want 5", results["sum"].Data)
+	}
+
+	nodes["c"] = constNode("c", "three", "a")
+	_, err = enginetest.RunAndCollect(engine.New(nodes))
+	if err == nil || !strings.Contains(err.Error(), "input c: invalid data type for c: expected int, got string") {
+		t.Errorf("mistyped input error = %v", err)
+	}
+}
+
+func TestPrettyPrintResults(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = constNode("b", struct{ Message string }{"hello"}, "a")
+	nodes["c"] = constNode("c", strings.Repeat("x", 200), "a")
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if _, err := e.RunNode("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RunNode("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RunNode("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	e.SetOutput(&out)
+	e.PrettyPrintResults()
+	for _, want := range []string{
+		"◉ b\n      └─ result: {Message:hello}\n",
+		"└─ result: " + strings.Repeat("x", 79) + "…\n",
+		"◉ d\n      └─ (no result yet)\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestErrSkip(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, fmt.Errorf("no new data: %w", engine.ErrSkip)
+		},
+	}
+	// d handles the skipped dependency, e passes the error on
+	nodes["d"] = engine.Node{
+		ID:        "d",
+		DependsOn: []string{"b", "c"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			b, err := engine.Require[int](ctx, deps, "b")
+			if errors.Is(err, engine.ErrSkip) {
+				b = 100
+			} else if err != nil {
+				return engine.Result{}, err
+			}
+			return engine.Result{ID: "d", Data: b}, nil
+		},
+	}
+	nodes["e"] = engine.Node{
+		ID:        "e",
+		DependsOn: []string{"b"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			_, err := engine.Require[int](ctx, deps, "b")
+			return engine.Result{ID: "e"}, err
+		},
+	}
+
+	e := engine.New(nodes)
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["d"].Data != 100 {
+		t.Errorf("d = %v, want the fallback 100", results["d"].Data)
+	}
+	skipped := e.Skipped()
+	if skipped["b"] != "skipped by node: no new data: skip node" {
+		t.Errorf("b skip reason = %q", skipped["b"])
+	}
+	if !strings.HasPrefix(skipped["e"], "skipped by node: node e: dependency b was skipped") {
+		t.Errorf("e skip reason = %q", skipped["e"])
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	nodes := diamond()
+	d := nodes["d"]
+	d.OptionalDeps = []string{"c"}
+	nodes["d"] = d
+
+	builder := engine.NewBuilder(nodes)
+	builder.SetEnabled(func(id string) bool { return id != "c" })
+
+	e, err := builder.BuildFor("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b"}, {"d"}})
+
+	if _, err := builder.BuildFor("c"); err == nil || err.Error() != "node c is disabled" {
+		t.Errorf("BuildFor(disabled) error = %v", err)
+	}
+
+	builder.SetEnabled(func(id string) bool { return id != "b" })
+	if _, err := builder.BuildFor("d"); err == nil || err.Error() != "node d depends on disabled node b" {
+		t.Errorf("BuildFor(hard dependency disabled) error = %v", err)
+	}
+}
+
+func TestFailureCancelsSiblings(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			select {
+			case <-ctx.Done():
+				return engine.Result{}, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return engine.Result{ID: "c"}, nil
+			}
+		},
+	}
+
+	start := time.Now()
+	_, err := enginetest.RunAndCollect(engine.New(nodes))
+	if err == nil || !strings.Contains(err.Error(), "node b failed: boom") {
+		t.Fatalf("Run() error = %v, want b's failure", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("run took %s, sibling wasn't canceled", elapsed)
+	}
+}
+
+func TestExplainInclusion(t *testing.T) {
+	nodes := diamond()
+	nodes["e"] = constNode("e", 5)
+	builder := engine.NewBuilder(nodes)
+
+	path, err := builder.ExplainInclusion("d", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "b", "a"}; !reflect.DeepEqual(path, want) {
+		t.Errorf("ExplainInclusion(d, a) = %v, want %v", path, want)
+	}
+
+	if _, err := builder.ExplainInclusion("d", "e"); err == nil {
+		t.Error("ExplainInclusion explained a node outside the build")
+	}
+}
+
+func TestBestEffort(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			<-ctx.Done()
+			return engine.Result{}, ctx.Err()
+		},
+	}
+	nodes["d"] = engine.Node{
+		ID:        "d",
+		DependsOn: []string{"b", "c"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			_, err := engine.Require[int](ctx, deps, "b")
+			if !errors.Is(err, engine.ErrTimedOut) {
+				return engine.Result{}, fmt.Errorf("reading b: got %v, want ErrTimedOut", err)
+			}
+			c, err := engine.Require[int](ctx, deps, "c")
+			return engine.Result{ID: "d", Data: c}, err
+		},
+	}
+
+	e := engine.New(nodes)
+	e.BestEffort(20 * time.Millisecond)
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["d"].Data != 3 {
+		t.Errorf("d = %v, want c's 3", results["d"].Data)
+	}
+	if got := e.TimedOut(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("TimedOut() = %v, want [b]", got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	original := engine.New(diamond())
+	recorded, err := enginetest.RunAndCollect(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded["b"] = engine.Result{ID: "b", Data: "canned"}
+	delete(recorded, "c")
+
+	replay := engine.Replay(original, recorded)
+	enginetest.AssertLevels(t, replay, [][]string{{"a"}, {"b", "c"}, {"d"}})
+	results, err := enginetest.RunAndCollect(replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["b"].Data != "canned" || results["d"].Data != 4 {
+		t.Errorf("replayed results = %v", results)
+	}
+	if _, ok := replay.Skipped()["c"]; !ok {
+		t.Error("c has no recorded result but wasn't skipped")
+	}
+}
+
+func TestReplayScheduling(t *testing.T) {
+	nodes := diamond()
+	b := nodes["b"]
+	b.ConditionalDeps = map[string]func(engine.Result) bool{
+		"a": func(r engine.Result) bool { return r.Data != 1 },
+	}
+	nodes["b"] = b
+	c := nodes["c"]
+	c.After = []string{"b"}
+	nodes["c"] = c
+	nodes["e"] = engine.Node{ID: "e", DependsOn: []string{"a"}, Detached: true, Run: constNode("e", 5).Run}
+
+	original := engine.New(nodes)
+	if _, err := enginetest.RunAndCollect(original); err != nil {
+		t.Fatal(err)
+	}
+	original.WaitDetached()
+
+	replay := engine.Replay(original, original.Results())
+	enginetest.AssertLevels(t, replay, [][]string{{"a"}, {"b", "e"}, {"c"}, {"d"}})
+	if _, err := enginetest.RunAndCollect(replay); err != nil {
+		t.Fatal(err)
+	}
+	replay.WaitDetached()
+	if !reflect.DeepEqual(replay.Skipped(), original.Skipped()) {
+		t.Errorf("replay skipped %v, want %v like the original", replay.Skipped(), original.Skipped())
+	}
+	if replay.Results()["e"].Data != 5 {
+		t.Errorf("replayed results = %v, want detached e", replay.Results())
+	}
+}
+
+func TestStrictNilData(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = constNode("b", nil, "a")
+	nodes["d"] = constNode("d", nil, "b", "c")
+
+	e := engine.New(nodes)
+	e.SetStrict(true)
+	_, err := enginetest.RunAndCollect(e)
+	if err == nil || !strings.Contains(err.Error(), "node b produced nil data but is depended on by [d]") {
+		t.Errorf("Run() error = %v, want b's nil data reported", err)
+	}
+
+	// d is a leaf, so its nil data is fine
+	nodes["b"] = constNode("b", 2, "a")
+	e = engine.New(nodes)
+	e.SetStrict(true)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Errorf("leaf with nil data failed the run: %v", err)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	apiNode := func(id string, deps ...string) engine.Node {
+		return engine.Node{
+			ID:               id,
+			DependsOn:        deps,
+			ConcurrencyGroup: "external-api",
+			Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return engine.Result{ID: id, Data: id}, nil
+			},
+		}
+	}
+
+	nodes := map[string]engine.Node{"a": constNode("a", 1)}
+	for _, id := range []string{"b", "c", "d", "e"} {
+		nodes[id] = apiNode(id, "a")
+	}
+	e := engine.New(nodes)
+	e.SetGroupLimit("external-api", 2)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("max concurrent group nodes = %d, want 2", maxRunning)
+	}
+}
+
+func TestCloneRunsConcurrently(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+	e.Seed(engine.Result{ID: "a", Data: 10})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		c := e.Clone()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Run(); err != nil {
+				t.Error(err)
+			}
+			if len(c.Results()) != 4 || c.Results()["a"].Data != 10 {
+				t.Errorf("clone results = %v", c.Results())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(e.Results()); got != 1 {
+		t.Errorf("original has %d results, want only the seed", got)
+	}
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	nodes := diamond()
+	nodes["c"] = constNode("c", strings.Repeat("x", 100), "a")
+
+	e := engine.New(nodes)
+	e.MaxResultBytes(50)
+	_, err := enginetest.RunAndCollect(e)
+	if !errors.Is(err, engine.ErrResultTooLarge) || !strings.Contains(err.Error(), "node c failed: output exceeds max result size\n") {
+		t.Errorf("Run() error = %v, want c rejected", err)
+	}
+}
+
+func TestVersionConstraints(t *testing.T) {
+	nodes := diamond()
+	a := nodes["a"]
+	a.Version = "2.1"
+	nodes["a"] = a
+	nodes["b"] = constNode("b", 2, "a@>=2")
+	nodes["c"] = constNode("c", 3, "a@>=2.10")
+
+	builder := engine.NewBuilder(nodes)
+	e, err := builder.BuildFor("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b"}})
+
+	_, err = builder.BuildFor("c")
+	if err == nil || err.Error() != "node c requires a@>=2.10 but a is version 2.1" {
+		t.Errorf("BuildFor(c) error = %v, want version incompatibility", err)
+	}
+	if err := engine.New(nodes).Validate(); err == nil {
+		t.Error("Validate() accepted an unsatisfied version constraint")
+	}
+}
+
+func TestScheduleGate(t *testing.T) {
+	// b may only start once c has run, even though they share a level
+	open, bGate := make(chan struct{}), make(chan struct{})
+	close(open)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(id string, deps ...string) engine.Node {
+		return engine.Node{
+			ID:        id,
+			DependsOn: deps,
+			Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+				if id == "c" {
+					close(bGate)
+				}
+				return engine.Result{ID: id, Data: id}, nil
+			},
+		}
+	}
+
+	e := engine.New(map[string]engine.Node{
+		"a": record("a"),
+		"b": record("b", "a"),
+		"c": record("c", "a"),
+	})
+	engine.SetScheduleGate(e, func(id string) <-chan struct{} {
+		if id == "b" {
+			return bGate
+		}
+		return open
+	})
+
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c", "b"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestLevelsDeterministic(t *testing.T) {
+	// Wide levels, so map iteration order would show up in them
+	nodes := map[string]engine.Node{"root": constNode("root", 0)}
+	var want [][]string
+	for _, prefix := range []string{"x", "y"} {
+		var level []string
+		for i := range 20 {
+			id := fmt.Sprintf("%s%02d", prefix, i)
+			if prefix == "x" {
+				nodes[id] = constNode(id, i, "root")
+			} else {
+				nodes[id] = constNode(id, i, fmt.Sprintf("x%02d", 19-i))
+			}
+			level = append(level, id)
+		}
+		want = append(want, level)
+	}
+	want = append([][]string{{"root"}}, want...)
+
+	for range 50 {
+		levels, err := engine.New(nodes).Levels()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(levels, want) {
+			t.Fatalf("Levels() = %v, want every level sorted by ID: %v", levels, want)
+		}
+	}
+}
+
+func TestResultLevel(t *testing.T) {
+	e := engine.New(diamond())
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"a": 0, "b": 1, "c": 1, "d": 2}
+	for id, level := range want {
+		if got := e.Results()[id].Level; got != level {
+			t.Errorf("%s Level = %d, want %d", id, got, level)
+		}
+	}
+
+	r, err := e.RunNode("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Level != 1 {
+		t.Errorf("RunNode(c).Level = %d, want 1", r.Level)
+	}
+}
+
+func TestBuilderStrict(t *testing.T) {
+	b := engine.NewBuilder(diamond()).Strict()
+
+	if _, err := b.BuildFor("b", "c"); err != nil {
+		t.Fatalf("BuildFor(b, c) = %v, want no error", err)
+	}
+	for _, targets := range [][]string{{"d", "b"}, {"b", "b"}} {
+		if _, err := b.BuildFor(targets...); err == nil {
+			t.Errorf("BuildFor(%v) succeeded, want an error", targets)
+		}
+		if _, err := b.BuildForCached(targets...); err == nil {
+			t.Errorf("BuildForCached(%v) succeeded, want an error", targets)
+		}
+	}
+
+	if _, err := engine.NewBuilder(diamond()).BuildFor("d", "b"); err != nil {
+		t.Errorf("non-strict BuildFor(d, b) = %v, want no error", err)
+	}
+}
+
+func TestPrettyPrintColor(t *testing.T) {
+	var buf bytes.Buffer
+	e := engine.New(diamond())
+	e.SetOutput(&buf)
+	e.PrettyPrint()
+	if strings.Contains(buf.String(), "\033[") {
+		t.Errorf("PrettyPrint to a buffer emitted ANSI colors:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	e.PrettyPrintColor(true)
+	e.PrettyPrint()
+	for _, want := range []string{"\033[32ma\033[0m", "\033[34md\033[0m"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("PrettyPrint output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDetached(t *testing.T) {
+	release := make(chan struct{})
+	nodes := map[string]engine.Node{
+		"a": constNode("a", 1),
+		"notify": {
+			ID:        "notify",
+			DependsOn: []string{"a"},
+			Detached:  true,
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				<-release
+				return engine.Result{}, errors.New("smtp down")
+			},
+		},
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	// Run must not wait for the blocked detached node
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := e.WaitDetached(); err == nil || !strings.Contains(err.Error(), "smtp down") {
+		t.Errorf("WaitDetached() = %v, want the detached node's failure", err)
+	}
+
+	nodes["b"] = constNode("b", 2, "notify")
+	if err := engine.New(nodes).Validate(); err == nil {
+		t.Error("Validate() = nil, want an error for a dependent of a detached node")
+	}
+}
+
+func TestRootsAndLeaves(t *testing.T) {
+	nodes := diamond()
+	nodes["e"] = constNode("e", 5, "a@>=1")
+	if got, want := engine.Roots(nodes), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Roots() = %v, want %v", got, want)
+	}
+	if got, want := engine.Leaves(nodes), []string{"d", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Leaves() = %v, want %v", got, want)
+	}
+}
+
+func TestRunContinueOnError(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+	nodes["e"] = constNode("e", 5, "c")
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	results, err := e.RunContinueOnError()
+	if err == nil || !strings.Contains(err.Error(), "node b failed: boom") {
+		t.Errorf("RunContinueOnError() error = %v, want b's failure", err)
+	}
+	for _, id := range []string{"a", "c", "e"} {
+		if _, ok := results[id]; !ok {
+			t.Errorf("results missing %s: %v", id, results)
+		}
+	}
+	if want := map[string]string{"d": "dependency b failed"}; !reflect.DeepEqual(e.Skipped(), want) {
+		t.Errorf("Skipped() = %v, want %v", e.Skipped(), want)
+	}
+}
+
+// foreignResult stands in for the Result type of another engine package
+type foreignResult struct{ ID string }
+
+func TestAssertSamePackage(t *testing.T) {
+	for _, node := range []any{constNode("a", 1), scaleNode{}, engine.RunFunc(nil)} {
+		if err := engine.AssertSamePackage(node); err != nil {
+			t.Errorf("AssertSamePackage(%T) = %v, want nil", node, err)
+		}
+	}
+
+	foreign := func(context.Context, map[string]foreignResult) (foreignResult, error) {
+		return foreignResult{}, nil
+	}
+	err := engine.AssertSamePackage(foreign)
+	if err == nil || !strings.Contains(err.Error(), "different engine package") {
+		t.Errorf("AssertSamePackage(foreign) = %v, want a package mismatch", err)
+	}
+}
+
+// countingLimiter records how often nodes waited and can refuse them
+type countingLimiter struct {
+	mu    sync.Mutex
+	waits int
+	err   error
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits++
+	return l.err
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	nodes := diamond()
+	for _, id := range []string{"b", "c"} {
+		n := nodes[id]
+		n.ConcurrencyGroup = "api"
+		nodes[id] = n
+	}
+
+	limiter := &countingLimiter{}
+	e := engine.New(nodes).WithRateLimiter("api", limiter)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.waits != 2 {
+		t.Errorf("limiter waited %d times, want 2 (once per api node)", limiter.waits)
+	}
+
+	limiter.err = context.Canceled
+	e.Reset()
+	if err := e.Run(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() = %v, want the limiter's error", err)
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	var finalized []string
+	finalize := func(id string) func(engine.Result, error) {
+		return func(res engine.Result, err error) {
+			finalized = append(finalized, fmt.Sprintf("%s:%v:%v", id, res.Data, err))
+		}
+	}
+
+	nodes := map[string]engine.Node{
+		"a": constNode("a", 1),
+		"b": {
+			ID:        "b",
+			DependsOn: []string{"a"},
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				return engine.Result{ID: "b", Data: "partial"}, errors.New("boom")
+			},
+		},
+	}
+	a, b := nodes["a"], nodes["b"]
+	a.Finalize, b.Finalize = finalize("a"), finalize("b")
+	nodes["a"], nodes["b"] = a, b
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err == nil {
+		t.Fatal("Run() = nil, want b's failure")
+	}
+	if want := []string{"a:1:<nil>", "b:partial:boom"}; !reflect.DeepEqual(finalized, want) {
+		t.Errorf("finalized = %v, want %v", finalized, want)
+	}
+}
+
+func TestNewNode(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"a": constNode("a", 2),
+		"label": engine.NewNode("label", []string{"a"}, func(ctx context.Context, in int) (string, error) {
+			return fmt.Sprintf("a=%d", in), nil
+		}),
+		"bad": engine.NewNode("bad", []string{"a"}, func(ctx context.Context, in string) (string, error) {
+			return in, nil
+		}),
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	r, err := e.RunNode("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err = e.RunNode("label"); err != nil || r.Data != "a=2" {
+		t.Errorf("RunNode(label) = %v, %v, want a=2", r.Data, err)
+	}
+	if _, err := e.RunNode("bad"); err == nil || !strings.Contains(err.Error(), "expected string") {
+		t.Errorf("RunNode(bad) error = %v, want a type mismatch", err)
+	}
+}
+
+func TestExecutions(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	order := e.ExecutionOrder()
+	if len(order) != 4 || order[0] != "a" || order[3] != "d" {
+		t.Errorf("ExecutionOrder() = %v, want a first and d last", order)
+	}
+
+	byID := make(map[string]engine.Execution)
+	for _, ex := range e.Executions() {
+		byID[ex.ID] = ex
+	}
+	for _, dep := range []string{"b", "c"} {
+		if byID["d"].Start.Before(byID[dep].End) {
+			t.Errorf("d started at %v before %s ended at %v", byID["d"].Start, dep, byID[dep].End)
+		}
+	}
+	if byID["d"].Level != 2 {
+		t.Errorf("d ran in level %d, want 2", byID["d"].Level)
+	}
+}
+
+func TestResultOf(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+	if _, err := engine.ResultOf[int](e, "d"); err == nil || err.Error() != "node d has no result" {
+		t.Errorf("ResultOf before run error = %v, want no result", err)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := engine.ResultOf[int](e, "d"); err != nil || d != 4 {
+		t.Errorf("ResultOf[int](d) = %v, %v, want 4", d, err)
+	}
+	if _, err := engine.ResultOf[string](e, "d"); err == nil || !strings.Contains(err.Error(), "expected string, got int") {
+		t.Errorf("ResultOf[string](d) error = %v, want a type mismatch", err)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	layout, err := engine.New(diamond()).Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []engine.LayoutNode{
+		{ID: "a", Level: 0, Index: 0},
+		{ID: "b", Level: 1, Index: 0},
+		{ID: "c", Level: 1, Index: 1},
+		{ID: "d", Level: 2, Index: 0},
+	}
+	if !reflect.DeepEqual(layout, want) {
+		t.Errorf("Layout() = %v, want %v", layout, want)
+	}
+}
+
+func TestLayoutEdges(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"record": {
+			ID: "record",
+			RunMulti: func(ctx context.Context, _ map[string]engine.Result) ([]engine.Result, error) {
+				return []engine.Result{{ID: "record/0"}}, nil
+			},
+		},
+		"renamed":  {ID: "renamed", Aliases: []string{"old"}},
+		"consumer": {ID: "consumer", DependsOn: []string{"record/0", "old"}},
+		"last":     {ID: "last", After: []string{"consumer"}},
+	}
+	e := engine.New(nodes)
+	layout, err := e.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := make(map[string]int)
+	for _, node := range layout {
+		levels[node.ID] = node.Level
+	}
+
+	for _, edge := range e.Spec().Edges {
+		from, ok := levels[edge.From]
+		to, ok2 := levels[edge.To]
+		if !ok || !ok2 {
+			t.Errorf("edge %v doesn't connect two laid-out nodes", edge)
+		} else if from >= to {
+			t.Errorf("edge %v points from level %d back to level %d", edge, from, to)
+		}
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	run := func(nodes map[string]engine.Node, targets ...string) *engine.Engine {
+		t.Helper()
+		e, err := engine.NewBuilder(nodes).BuildFor(targets...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.SetOutput(io.Discard)
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	left, right := run(diamond(), "b"), run(diamond(), "c")
+	merged, err := engine.MergeResults(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged) != 3 {
+		t.Errorf("MergeResults() = %v, want a, b and c", merged)
+	}
+
+	other := diamond()
+	other["a"] = constNode("a", 100)
+	if _, err := engine.MergeResults(left, run(other, "c")); err == nil || !strings.Contains(err.Error(), "for: a") {
+		t.Errorf("MergeResults() with differing a error = %v, want a collision on a", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	nodes := make(map[string]engine.Node)
+	for id, node := range diamond() {
+		run := node.Run
+		node.Run = func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			mu.Lock()
+			runs[id]++
+			mu.Unlock()
+			return run(ctx, deps)
+		}
+		nodes[id] = node
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	trigger := make(chan string)
+	done := make(chan error)
+	go func() { done <- e.Watch(context.Background(), trigger) }()
+
+	// Closing the trigger ends Watch once the re-run for b finished
+	trigger <- "b"
+	close(trigger)
+	if err := <-done; err != nil {
+		t.Fatalf("Watch() = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := map[string]int{"a": 1, "b": 2, "c": 1, "d": 2}; !reflect.DeepEqual(runs, want) {
+		t.Errorf("runs = %v, want %v", runs, want)
+	}
+	if len(e.Results()) != 4 {
+		t.Errorf("Results() = %v, want all four nodes", e.Results())
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"a":    constNode("a", 1, "ghost"),
+		"b":    constNode("b", 2, "b"),
+		"c":    constNode("c", 3, "d"),
+		"d":    constNode("d", 4, "c"),
+		"e":    constNode("e", 5, "phantom"),
+		"real": constNode("fake", 6),
+	}
+	err := engine.New(nodes).Validate()
+	var verr *engine.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want a *ValidationError", err)
+	}
+	want := []string{
+		"node a depends on unknown node ghost",
+		"node b depends on itself",
+		"nodes c, d form a dependency cycle",
+		"node e depends on unknown node phantom",
+		"node fake is registered under ID real",
+	}
+	var got []string
+	for _, p := range verr.Problems {
+		got = append(got, p.Message)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems = %q, want %q", got, want)
+	}
+	if lines := strings.Count(err.Error(), "\n"); lines != len(want) {
+		t.Errorf("Error() has %d problem lines, want %d:\n%s", lines, len(want), err)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	// sum expects its input under "x", whoever produces it
+	sum := engine.Node{
+		ID:        "sum",
+		DependsOn: []string{"b"},
+		Adapt: func(deps map[string]engine.Result) (map[string]engine.Result, error) {
+			return map[string]engine.Result{"x": deps["b"]}, nil
+		},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			x, err := engine.Require[int](ctx, deps, "x")
+			return engine.Result{ID: "sum", Data: x + 10}, err
+		},
+	}
+	nodes := diamond()
+	nodes["sum"] = sum
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Results()["sum"].Data; got != 12 {
+		t.Errorf("sum = %v, want 12", got)
+	}
+}
+
+func TestSubGraphNode(t *testing.T) {
+	// The sub-graph doubles the parent's "a" and adds one
+	sub := engine.New(map[string]engine.Node{
+		"double": engine.NewNode("double", []string{"a"}, func(ctx context.Context, a int) (int, error) {
+			return 2 * a, nil
+		}),
+		"inc": engine.NewNode("inc", []string{"double"}, func(ctx context.Context, v int) (int, error) {
+			return v + 1, nil
+		}),
+	})
+
+	nodes := diamond()
+	nodes["pipeline"] = engine.SubGraphNode("pipeline", []string{"a"}, sub)
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := engine.ResultOf[int](e, "pipeline"); err != nil || got != 3 {
+		t.Errorf("pipeline = %v, %v, want 3", got, err)
+	}
+}
+
+func TestTimelineJSON(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var timeline []engine.TimelineEntry
+	if err := json.Unmarshal(e.TimelineJSON(), &timeline); err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 4 || timeline[0].ID != "a" || timeline[3].ID != "d" {
+		t.Fatalf("timeline = %+v, want a first and d last", timeline)
+	}
+	for _, entry := range timeline {
+		if entry.StartMS < 0 || entry.EndMS < entry.StartMS {
+			t.Errorf("entry %+v has invalid offsets", entry)
+		}
+	}
+}
+
+func TestSetErrorFormatter(t *testing.T) {
+	errBoom := errors.New("boom\ngoroutine 1 [running]: ...")
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errBoom
+		},
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), "node b failed: boom") {
+		t.Errorf("default format = %v, want node b failed: boom", err)
+	}
+
+	e.Reset()
+	e.SetErrorFormatter(func(nodeID string, err error) string {
+		first, _, _ := strings.Cut(err.Error(), "\n")
+		return nodeID + ": " + first
+	})
+	err = e.Run()
+	if err == nil || err.Error() != "b: boom" {
+		t.Errorf("custom format = %q, want %q", err, "b: boom")
+	}
+	var nodeErr *engine.NodeError
+	if !errors.Is(err, errBoom) || !errors.As(err, &nodeErr) || nodeErr.Node != "b" {
+		t.Errorf("error %v doesn't unwrap to b's NodeError and error", err)
+	}
+}
+
+func TestSetErrorFormatterChecks(t *testing.T) {
+	format := func(nodeID string, err error) string { return "formatted " + nodeID }
+
+	big := engine.New(map[string]engine.Node{"big": constNode("big", strings.Repeat("x", 100))})
+	big.SetOutput(io.Discard)
+	big.SetErrorFormatter(format)
+	big.MaxResultBytes(10)
+
+	nilData := engine.New(map[string]engine.Node{"a": constNode("a", nil), "b": constNode("b", 1, "a")})
+	nilData.SetOutput(io.Discard)
+	nilData.SetErrorFormatter(format)
+	nilData.SetStrict(true)
+
+	for id, e := range map[string]*engine.Engine{"big": big, "a": nilData} {
+		err := e.Run()
+		var nodeErr *engine.NodeError
+		if !errors.As(err, &nodeErr) || nodeErr.Node != id || err.Error() != "formatted "+id {
+			t.Errorf("Run() = %v, want %s's check failure through the formatter", err, id)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	nodes := map[string]engine.Node{
+		"clear": constNode("clear", "cleared"),
+		"warm": {
+			ID:    "warm",
+			After: []string{"clear", "not-in-graph"},
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				if len(deps) != 0 {
+					return engine.Result{}, fmt.Errorf("got deps %v, want none", deps)
+				}
+				return engine.Result{ID: "warm", Data: "warmed"}, nil
+			},
+		},
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	enginetest.AssertLevels(t, e, [][]string{{"clear"}, {"warm"}})
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	cyclic := map[string]engine.Node{
+		"a": {ID: "a", After: []string{"b"}},
+		"b": {ID: "b", DependsOn: []string{"a"}},
+	}
+	if err := engine.New(cyclic).Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Validate() = %v, want a cycle through After", err)
+	}
+}
+
+func TestEstimatedDuration(t *testing.T) {
+	nodes := diamond()
+	for id, cost := range map[string]time.Duration{"a": 10 * time.Second, "b": 20 * time.Second, "c": 5 * time.Second, "d": 10 * time.Second} {
+		n := nodes[id]
+		n.Cost = cost
+		nodes[id] = n
+	}
+	e := engine.New(nodes)
+
+	estimate, err := e.EstimatedDuration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate != 40*time.Second {
+		t.Errorf("EstimatedDuration() = %s, want 40s", estimate)
+	}
+	if err := e.CheckDeadline(30 * time.Second); err == nil || err.Error() != "graph is estimated to take 40s but the deadline is 30s" {
+		t.Errorf("CheckDeadline(30s) = %v, want the estimate to exceed it", err)
+	}
+	if err := e.CheckDeadline(time.Minute); err != nil {
+		t.Errorf("CheckDeadline(1m) = %v, want nil", err)
+	}
+
+	// e is on a path as long as a → b → d, not after the slowest node of
+	// each level
+	e2 := constNode("e", 5, "c")
+	e2.Cost = 25 * time.Second
+	nodes["e"] = e2
+	if estimate, err := engine.New(nodes).EstimatedDuration(); err != nil || estimate != 40*time.Second {
+		t.Errorf("EstimatedDuration() with e = %s, %v, want 40s", estimate, err)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []engine.Option
+	}{
+		{"levels", nil},
+		{"ready", []engine.Option{engine.WithReadyScheduler()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			var returned atomic.Bool
+			nodes := diamond()
+			nodes["b"] = engine.Node{
+				ID:        "b",
+				DependsOn: []string{"a"},
+				Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+					return engine.Result{}, errors.New("boom")
+				},
+			}
+			nodes["c"] = engine.Node{
+				ID:        "c",
+				DependsOn: []string{"a"},
+				Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+					<-release // ignores ctx
+					defer returned.Store(true)
+					return engine.Result{ID: "c", Data: 3}, nil
+				},
+			}
+			e := engine.New(nodes, tc.opts...)
+			e.SetOutput(io.Discard)
+			e.FailFast()
+
+			done := make(chan error)
+			go func() { done <- e.Run() }()
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), "boom") {
+					t.Errorf("Run() = %v, want b's failure", err)
+				}
+			case <-time.After(5 * time.Second):
+				close(release)
+				t.Fatal("Run() waited for c despite FailFast")
+			}
+
+			// c's result arrives after the run returned and is dropped
+			close(release)
+			for !returned.Load() {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if _, ok := e.Results()["c"]; ok {
+				t.Errorf("Results() = %v, want c's late result dropped", e.Results())
+			}
+		})
+	}
+}
+
+func TestWithContinueOnError(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+	nodes["e"] = constNode("e", 5, "c")
+
+	e := engine.New(nodes, engine.WithContinueOnError())
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), "node b failed: boom") {
+		t.Errorf("Run() = %v, want b's failure", err)
+	}
+	if _, ok := e.Results()["e"]; !ok {
+		t.Errorf("Results() = %v, want the unrelated branch to complete", e.Results())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	nodes := map[string]engine.Node{
+		"flaky": {
+			ID:    "flaky",
+			Retry: engine.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Jitter: 0.5},
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				attempts++
+				if attempts < 3 {
+					return engine.Result{}, errors.New("connection reset")
+				}
+				return engine.Result{ID: "flaky", Data: attempts}, nil
+			},
+		},
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatalf("Run() = %v, want success on the third attempt", err)
+	}
+
+	// Starting the count below zero makes all three attempts fail
+	attempts = -3
+	e.Reset()
+	if err := e.Run(); err == nil || attempts != 0 {
+		t.Errorf("Run() = %v after %d attempts, want failure after 3", err, attempts+3)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := engine.RetryPolicy{Backoff: time.Second}
+	for attempt, want := range map[int]time.Duration{1: time.Second, 3: 4 * time.Second, 40: math.MaxInt64, 1000: math.MaxInt64} {
+		if got := engine.RetryDelay(p, attempt); got != want {
+			t.Errorf("delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	p.MaxBackoff = time.Minute
+	if got := engine.RetryDelay(p, 1000); got != time.Minute {
+		t.Errorf("capped delay(1000) = %v, want 1m", got)
+	}
+
+	seeded := func() engine.RetryPolicy {
+		return engine.RetryPolicy{Backoff: time.Second, Jitter: 0.5, Rand: rand.New(rand.NewPCG(1, 2))}
+	}
+	first, second := seeded(), seeded()
+	for attempt := 1; attempt <= 5; attempt++ {
+		a, b := engine.RetryDelay(first, attempt), engine.RetryDelay(second, attempt)
+		if a != b {
+			t.Errorf("delay(%d) = %v and %v from the same seed", attempt, a, b)
+		}
+		if base := time.Second << (attempt - 1); a < base/2 || a > base*3/2 {
+			t.Errorf("delay(%d) = %v, want within ±50%% of %v", attempt, a, base)
+		}
+	}
+	if got := engine.RetryDelay(seeded(), 100); got <= 0 {
+		t.Errorf("jittered saturated delay = %v, want positive", got)
+	}
+}
+
+func TestRetrySharedRand(t *testing.T) {
+	// One seeded policy shared by nodes and engines retrying at the same
+	// time, checked under the race detector
+	policy := engine.RetryPolicy{MaxAttempts: 2, Backoff: time.Microsecond, Jitter: 0.5, Rand: rand.New(rand.NewPCG(1, 2))}
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	nodes := make(map[string]engine.Node)
+	for i := range 8 {
+		id := fmt.Sprintf("n%d", i)
+		nodes[id] = engine.Node{ID: id, Retry: policy, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			// Every run's first attempt fails
+			runID, _ := engine.RunID(ctx)
+			mu.Lock()
+			attempts[runID+id]++
+			first := attempts[runID+id] == 1
+			mu.Unlock()
+			if first {
+				return engine.Result{}, errors.New("transient")
+			}
+			return engine.Result{ID: id}, nil
+		}}
+	}
+
+	e := engine.New(nodes)
+	var wg sync.WaitGroup
+	for _, run := range []*engine.Engine{e, e.Clone()} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := enginetest.RunAndCollect(run); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWithReadyScheduler(t *testing.T) {
+	// c only finishes once e ran, but e is a level after c and depends only
+	// on b: level by level this would never finish
+	eRan := make(chan struct{})
+	nodes := diamond()
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			select {
+			case <-eRan:
+				return engine.Result{ID: "c", Data: 3}, nil
+			case <-ctx.Done():
+				return engine.Result{}, ctx.Err()
+			}
+		},
+	}
+	nodes["e"] = engine.Node{
+		ID:        "e",
+		DependsOn: []string{"b"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			close(eRan)
+			return engine.Result{ID: "e"}, nil
+		},
+	}
+
+	e := engine.New(nodes, engine.WithReadyScheduler())
+	e.SetOutput(io.Discard)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.RunContext(ctx); err != nil {
+		t.Fatalf("RunContext() = %v, want e to start without waiting for c", err)
+	}
+	if got := e.Results()["d"].Level; got != 2 {
+		t.Errorf("Results()[d].Level = %d, want 2", got)
+	}
+}
+
+func TestWithMaxConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	nodes := make(map[string]engine.Node)
+	for i := range 20 {
+		id := fmt.Sprintf("n%02d", i)
+		nodes[id] = engine.Node{
+			ID: id,
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				return engine.Result{ID: id}, nil
+			},
+		}
+	}
+
+	e := engine.New(nodes, engine.WithMaxConcurrency(3))
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("peak concurrency = %d, want at most 3", got)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var finalized error
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			panic("boom")
+		},
+		Finalize: func(res engine.Result, err error) { finalized = err },
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	err := e.Run()
+	var panicErr *engine.PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Fatalf("Run() = %v, want a PanicError for boom", err)
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "node b failed: panic: boom") || !strings.Contains(msg, "goroutine") {
+		t.Errorf("Run() error = %q, want the panic and its stack trace", msg)
+	}
+	if !errors.As(finalized, &panicErr) {
+		t.Errorf("Finalize got %v, want the PanicError", finalized)
+	}
+}
+
+func TestTypedNode(t *testing.T) {
+	type in struct {
+		B     int `dep:"b"`
+		C     int `dep:"c"`
+		local string
+	}
+	nodes := diamond()
+	sum, err := engine.TypedNode[in, int]{
+		ID:        "sum",
+		DependsOn: []string{"b", "c"},
+		Run: func(ctx context.Context, in in) (int, error) {
+			return in.B + in.C, nil
+		},
+	}.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes["sum"] = sum
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Results()["sum"].Data; got != 5 {
+		t.Errorf("sum = %v, want 5", got)
+	}
+
+	type wrong struct {
+		A string `dep:"a"`
+	}
+	nodes["sum"], err = engine.TypedNode[wrong, int]{
+		ID:        "sum",
+		DependsOn: []string{"a"},
+		Run:       func(ctx context.Context, in wrong) (int, error) { return 0, nil },
+	}.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = engine.New(nodes)
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), "expected string, got int") {
+		t.Errorf("Run() = %v, want a type mismatch", err)
+	}
+}
+
+func TestTypedNodeDeclaration(t *testing.T) {
+	type in struct {
+		B int `dep:"b"`
+	}
+	run := func(ctx context.Context, in in) (int, error) { return in.B, nil }
+	if _, err := (engine.TypedNode[in, int]{ID: "x", DependsOn: []string{"b@>=2"}, Run: run}).Node(); err != nil {
+		t.Errorf("Node() with a versioned dependency = %v, want nil", err)
+	}
+	if _, err := (engine.TypedNode[in, int]{ID: "x", DependsOn: []string{"c"}, Run: run}).Node(); err == nil || !strings.Contains(err.Error(), "doesn't match the dep tags") {
+		t.Errorf("Node() with mismatched DependsOn = %v, want an error", err)
+	}
+	if _, err := (engine.TypedNode[in, int]{ID: "x", Run: run}).Node(); err == nil {
+		t.Error("Node() without DependsOn = nil, want an error")
+	}
+
+	type unexported struct {
+		b int `dep:"b"`
+	}
+	_, err := engine.TypedNode[unexported, int]{
+		ID:        "x",
+		DependsOn: []string{"b"},
+		Run:       func(ctx context.Context, in unexported) (int, error) { return in.b, nil },
+	}.Node()
+	if err == nil || !strings.Contains(err.Error(), "field b reads b but is unexported") {
+		t.Errorf("Node() with an unexported field = %v, want an error", err)
+	}
+
+	if _, err := (engine.TypedNode[int, int]{ID: "x"}).Node(); err == nil || !strings.Contains(err.Error(), "input must be a struct") {
+		t.Errorf("Node() with a non-struct input = %v, want an error", err)
+	}
+}
+
+func TestResultAs(t *testing.T) {
+	deps := map[string]engine.Result{"a": {ID: "a", Data: 1}}
+	if got, err := engine.ResultAs[int](deps, "a"); err != nil || got != 1 {
+		t.Errorf("ResultAs[int](a) = %v, %v, want 1", got, err)
+	}
+	if _, err := engine.ResultAs[string](deps, "a"); err == nil || !strings.Contains(err.Error(), "expected string, got int") {
+		t.Errorf("ResultAs[string](a) = %v, want a type mismatch", err)
+	}
+	if _, err := engine.ResultAs[int](deps, "b"); err == nil || err.Error() != "b result not found in deps" {
+		t.Errorf("ResultAs[int](b) = %v, want not found", err)
+	}
+}
+
+func TestRunIsolated(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			results, err := e.RunIsolated(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got := results["d"].Data; got != 4 {
+				t.Errorf("RunIsolated()[d] = %v, want 4", got)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := e.Results(); len(got) != 0 {
+		t.Errorf("Results() = %v, want the engine itself untouched", got)
+	}
+}
+
+func TestRunIsolatedInterrupted(t *testing.T) {
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	nodes := diamond()
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(context.Context, map[string]engine.Result) (engine.Result, error) {
+			defer close(returned)
+			<-release // ignores ctx
+			return engine.Result{ID: "c", Data: "late"}, nil
+		},
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	results, err := e.RunIsolated(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunIsolated() = %v, want deadline exceeded", err)
+	}
+	want := len(results)
+
+	// The abandoned node finishing must not write into the returned map
+	close(release)
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := results["c"]; ok || len(results) != want {
+		t.Errorf("RunIsolated() results changed to %v after returning", results)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+
+	results, errs := e.RunStream(context.Background())
+	var order []string
+	for result := range results {
+		order = append(order, result.ID)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 4 || order[0] != "a" || order[3] != "d" {
+		t.Errorf("streamed %v, want a first and d last", order)
+	}
+	if got := e.Results()["d"].Data; got != 4 {
+		t.Errorf("Results()[d] = %v, want 4", got)
+	}
+}
+
+func TestRunStreamConcurrentClone(t *testing.T) {
+	// a holds the stream's run until a clone was taken mid-run
+	cloned := make(chan struct{})
+	nodes := diamond()
+	nodes["a"] = engine.Node{ID: "a", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+		<-cloned
+		return engine.Result{ID: "a", Data: 1}, nil
+	}}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+
+	results, errs := e.RunStream(context.Background())
+	c := e.Clone()
+	close(cloned)
+	if _, err := enginetest.RunAndCollect(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the stream's own run sends on it
+	var streamed int
+	for range results {
+		streamed++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if streamed != 4 {
+		t.Errorf("streamed %d results, want the 4 of the stream's run", streamed)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	nodes := diamond()
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+
+	var mu sync.Mutex
+	var started, succeeded, failed []string
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	e.OnNodeStart(func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, id)
+	}).OnNodeSuccess(func(id string, res engine.Result, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		succeeded = append(succeeded, fmt.Sprintf("%s=%v", id, res.Data))
+	}).OnNodeError(func(id string, err error, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, fmt.Sprintf("%s: %v", id, err))
+	})
+	e.Run()
+
+	slices.Sort(started)
+	slices.Sort(succeeded)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(started, want) {
+		t.Errorf("started %v, want %v", started, want)
+	}
+	if want := []string{"a=1", "b=2"}; !reflect.DeepEqual(succeeded, want) {
+		t.Errorf("succeeded %v, want %v", succeeded, want)
+	}
+	if want := []string{"c: boom"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed %v, want %v", failed, want)
+	}
+}
+
+func TestHooksHalt(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, engine.ErrHalt
+		},
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	e.OnNodeError(func(id string, err error, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, id)
+	})
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) > 0 {
+		t.Errorf("OnNodeError called for %v, want no call for a halt", failed)
+	}
+}
+
+func TestUse(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	trace := func(name string) engine.Middleware {
+		return func(next engine.RunFunc) engine.RunFunc {
+			return func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				id, _ := engine.NodeID(ctx)
+				mu.Lock()
+				calls = append(calls, name+":"+id)
+				mu.Unlock()
+				return next(ctx, deps)
+			}
+		}
+	}
+
+	b := engine.NewBuilder(map[string]engine.Node{"a": constNode("a", 1)}, engine.WithMiddleware(trace("outer")))
+	e, err := b.BuildFor("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetOutput(io.Discard)
+	e.Use(trace("inner"))
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"outer:a", "inner:a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil)) // Info and above
+	e := engine.New(map[string]engine.Node{"a": constNode("a", 1)}, engine.WithLogger(logger))
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("want a single completed record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "completed" || record["node"] != "a" || record["level"] != "INFO" {
+		t.Errorf("record = %v, want node a completed at INFO", record)
+	}
+}
+
+func TestWithLoggerHalt(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	nodes := map[string]engine.Node{
+		"a": {ID: "a", Run: func(context.Context, map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, engine.ErrHalt
+		}},
+	}
+	e := engine.New(nodes, engine.WithLogger(logger))
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("halt logged at Warn or above: %s", buf.String())
+	}
+
+	buf.Reset()
+	logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	e = engine.New(nodes, engine.WithLogger(logger))
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("want a single halted record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "halted" || record["node"] != "a" || record["level"] != "INFO" {
+		t.Errorf("record = %v, want node a halted at INFO", record)
+	}
+}
+
+// countingMetrics counts the runs and failures reported to it
+type countingMetrics struct {
+	mu       sync.Mutex
+	graphs   []string
+	failures []string
+}
+
+func (m *countingMetrics) RunStarted(graph string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.graphs = append(m.graphs, graph)
+}
+func (m *countingMetrics) NodeCompleted(string, time.Duration) {}
+func (m *countingMetrics) LevelStarted(int, int)               {}
+func (m *countingMetrics) NodeFailed(nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, nodeID)
+}
+
+func TestWithMetricsFailures(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(context.Context, map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, engine.ErrHalt
+		},
+	}
+	nodes["c"] = engine.Node{
+		ID:        "c",
+		DependsOn: []string{"a"},
+		Run: func(context.Context, map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+
+	m := &countingMetrics{}
+	e := engine.New(nodes, engine.WithMetrics(m))
+	e.SetOutput(io.Discard)
+	e.Run()
+	if want := []string{"c"}; !reflect.DeepEqual(m.failures, want) {
+		t.Errorf("failures = %v, want only %v, not the halt", m.failures, want)
+	}
+}
+
+func TestWithMetricsGraphName(t *testing.T) {
+	m := &countingMetrics{}
+	b := engine.NewBuilder(diamond(), engine.WithMetrics(m))
+
+	e := engine.New(diamond(), engine.WithMetrics(m))
+	e.SetOutput(io.Discard)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, named := range []bool{false, true} {
+		e, err := b.BuildFor("d", "b", "d")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if named {
+			e.SetGraphName("custom")
+		}
+		e.SetOutput(io.Discard)
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := []string{"all", "b,d", "custom"}; !reflect.DeepEqual(m.graphs, want) {
+		t.Errorf("graphs = %v, want %v", m.graphs, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	nodes := diamond()
+	nodes["b"] = engine.Node{
+		ID:        "b",
+		DependsOn: []string{"a"},
+		Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		},
+	}
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	runErr := e.Run()
+
+	report := e.Report()
+	if report.RunID != e.LastRunID() || report.Error != runErr.Error() || report.End.Before(report.Start) {
+		t.Errorf("report = %+v, want the run's ID, error and span", report)
+	}
+	statuses := make(map[string]engine.NodeStatus)
+	for _, node := range report.Nodes {
+		statuses[node.ID] = node.Status
+	}
+	want := map[string]engine.NodeStatus{
+		"a": engine.StatusCompleted,
+		"b": engine.StatusFailed,
+		"c": engine.StatusCompleted,
+		"d": engine.StatusNotRun,
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if b := report.Nodes[1]; b.ID != "b" || b.Level != 1 || b.Error != "boom" || b.Start.IsZero() {
+		t.Errorf("report of b = %+v, want level 1 with its error and timing", b)
+	}
+}
+
+func TestLoadDefinition(t *testing.T) {
+	b := engine.NewBuilder(diamond())
+
+	// d only needs b once c is cut out
+	rewired, err := b.LoadDefinition(strings.NewReader(`{"nodes": [{"id": "d", "depends_on": ["b"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := rewired.BuildFor("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.AssertLevels(t, e, [][]string{{"a"}, {"b"}, {"d"}})
+
+	_, err = b.LoadDefinition(strings.NewReader(`{"nodes": [{"id": "x"}, {"id": "a", "depends_on": ["d"]}]}`))
+	var verr *engine.ValidationError
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "x, which is not in the catalog") {
+		t.Errorf("LoadDefinition() = %v, want the unknown node reported", err)
+	}
+	_, err = b.LoadDefinition(strings.NewReader(`{"nodes": [{"id": "a", "depends_on": ["d"]}]}`))
+	if !errors.As(err, &verr) || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("LoadDefinition() = %v, want the cycle reported", err)
+	}
+}
+
+func TestPrettyString(t *testing.T) {
+	var out bytes.Buffer
+	e := engine.New(diamond())
+	e.SetOutput(&out)
+
+	got := e.PrettyString()
+	for _, want := range []string{"◉ a\n", "└─ required by: b, c\n", "Level 1 (parallel):\n    → b\n    → c\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PrettyString() is missing %q:\n%s", want, got)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("PrettyString() wrote to the engine output:\n%s", out.String())
+	}
+
+	var w bytes.Buffer
+	e.PrettyPrintTo(&w)
+	if w.String() != got {
+		t.Errorf("PrettyPrintTo() = %q, want PrettyString's rendering", w.String())
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := engine.New(diamond()).WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"digraph graph_builder {\n", `  "a" -> "b";` + "\n", `  "c" -> "d";` + "\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteDOT() is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	nodes := diamond()
+	nodes["x"] = constNode("x", 0)
+
+	e, err := engine.NewBuilder(nodes).BuildFor("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Orphans(); len(got) != 0 {
+		t.Errorf("BuildFor(d).Orphans() = %v, want none", got)
+	}
+
+	// Without targets every leaf counts, including the unrelated x
+	if got, want := engine.New(nodes).Orphans(), []string{"d", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("New().Orphans() = %v, want %v", got, want)
+	}
+}
+
+func TestSetLevelParallelism(t *testing.T) {
+	// The wide level only finishes if all four of its nodes run at once
+	var arrived atomic.Int32
+	var running, peak atomic.Int32
+	nodes := make(map[string]engine.Node)
+	for i := range 4 {
+		wide := fmt.Sprintf("wide%d", i)
+		nodes[wide] = engine.Node{
+			ID: wide,
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				arrived.Add(1)
+				for arrived.Load() < 4 {
+					select {
+					case <-ctx.Done():
+						return engine.Result{}, ctx.Err()
+					case <-time.After(time.Millisecond):
+					}
+				}
+				return engine.Result{ID: wide}, nil
+			},
+		}
+
+		narrow := fmt.Sprintf("narrow%d", i)
+		nodes[narrow] = engine.Node{
+			ID:        narrow,
+			DependsOn: []string{"wide0"},
+			Run: func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				return engine.Result{ID: narrow}, nil
+			},
+		}
+	}
+
+	e := engine.New(nodes)
+	e.SetOutput(io.Discard)
+	e.SetMaxParallelism(1)
+	e.SetLevelParallelism(0, 0) // unlimited despite the global limit
+	if err := e.RunWithDeadline(5 * time.Second); err != nil {
+		t.Fatalf("Run() = %v, want level 0 to run all its nodes at once", err)
+	}
+	if got := peak.Load(); got != 1 {
+		t.Errorf("level 1 peak concurrency = %d, want the global limit of 1", got)
+	}
+}
+
+func TestUnused(t *testing.T) {
+	nodes := diamond()
+	nodes["x"] = constNode("x", 0)
+	b := engine.NewBuilder(nodes)
+
+	if got, err := b.Unused("b"); err != nil || !reflect.DeepEqual(got, []string{"c", "d", "x"}) {
+		t.Errorf("Unused(b) = %v, %v, want [c d x]", got, err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	b.WarnUnused(true)
+	if _, err := b.BuildFor("d"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "registered nodes contribute nothing to targets [d]: x"; !strings.Contains(logs.String(), want) {
+		t.Errorf("BuildFor(d) logged %q, want %q", logs.String(), want)
+	}
+}
+
+func TestBufferNodeOutput(t *testing.T) {
+	// b and c alternate their lines: b1, c1, then b2 and c2
+	run := func(buffered bool) []string {
+		bPrinted, cPrinted := make(chan struct{}), make(chan struct{})
+		nodes := diamond()
+		nodes["b"] = engine.Node{ID: "b", DependsOn: []string{"a"}, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			engine.Printf(ctx, "b1\n")
+			close(bPrinted)
+			<-cPrinted
+			engine.Printf(ctx, "b2\n")
+			return engine.Result{ID: "b", Data: 2}, nil
+		}}
+		nodes["c"] = engine.Node{ID: "c", DependsOn: []string{"a"}, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			<-bPrinted
+			engine.Printf(ctx, "c1\n")
+			close(cPrinted)
+			engine.Printf(ctx, "c2\n")
+			return engine.Result{ID: "c", Data: 3}, nil
+		}}
+
+		var out bytes.Buffer
+		e := engine.New(nodes)
+		e.SetOutput(&out)
+		e.BufferNodeOutput(buffered)
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return slices.DeleteFunc(strings.Split(out.String(), "\n"), func(line string) bool {
+			return !slices.Contains([]string{"b1", "b2", "c1", "c2"}, line)
+		})
+	}
+
+	if got := run(false); !slices.Equal(got[:2], []string{"b1", "c1"}) {
+		t.Errorf("unbuffered output = %v, want b1 and c1 interleaved", got)
+	}
+	got := run(true)
+	if b := slices.Index(got, "b1"); b < 0 || b+1 >= len(got) || got[b+1] != "b2" {
+		t.Errorf("buffered output = %v, want b's lines together", got)
+	}
+	if c := slices.Index(got, "c1"); c < 0 || c+1 >= len(got) || got[c+1] != "c2" {
+		t.Errorf("buffered output = %v, want c's lines together", got)
+	}
+}
+
+func TestCost(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	node := func(id string, cost, sleep time.Duration) engine.Node {
+		return engine.Node{ID: id, Cost: cost, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			mu.Lock()
+			order = append(order, id)
+			mu.Unlock()
+			time.Sleep(sleep)
+			return engine.Result{ID: id}, nil
+		}}
+	}
+	e := engine.New(map[string]engine.Node{
+		"a":    node("a", time.Millisecond, 0),
+		"b":    node("b", time.Millisecond, 20*time.Millisecond),
+		"c":    node("c", 0, 0),
+		"slow": node("slow", time.Hour, 0),
+	})
+	e.SetOutput(io.Discard)
+	e.SetMaxParallelism(1)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The most expensive node starts first, ties and unannotated nodes by ID
+	if want := []string{"slow", "a", "b", "c"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("start order = %v, want %v", order, want)
+	}
+	slow := e.SlowNodes(2)
+	if len(slow) != 1 || slow[0].ID != "b" || slow[0].Estimated != time.Millisecond || slow[0].Actual < 20*time.Millisecond {
+		t.Errorf("SlowNodes(2) = %+v, want only b, estimated at 1ms", slow)
+	}
+}
+
+func TestResultMeta(t *testing.T) {
+	e := engine.New(map[string]engine.Node{
+		"load": {ID: "load", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{ID: "load", Data: 1, Meta: map[string]string{"rows_processed": "1200", "cache_hit": "true"}}, nil
+		}},
+	})
+	var out bytes.Buffer
+	e.SetOutput(&out)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "✓ load completed (cache_hit=true, rows_processed=1200)"; !strings.Contains(out.String(), want) {
+		t.Errorf("output is missing %q:\n%s", want, out.String())
+	}
+
+	data, err := json.Marshal(e.Results()["load"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"Meta":{"cache_hit":"true","rows_processed":"1200"}`; !strings.Contains(string(data), want) {
+		t.Errorf("result JSON = %s, want %s", data, want)
+	}
+}
+
+func TestVerifyIdempotent(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+	if err := e.VerifyIdempotent(); err != nil {
+		t.Errorf("VerifyIdempotent() on a deterministic graph = %v", err)
+	}
+
+	var calls atomic.Int64
+	counter := func(nonDeterministic bool) map[string]engine.Node {
+		return map[string]engine.Node{
+			"a": constNode("a", 1),
+			"count": {ID: "count", DependsOn: []string{"a"}, NonDeterministic: nonDeterministic,
+				Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+					return engine.Result{ID: "count", Data: calls.Add(1)}, nil
+				}},
+		}
+	}
+
+	e = engine.New(counter(false))
+	e.SetOutput(io.Discard)
+	err := e.VerifyIdempotent()
+	if err == nil || !strings.Contains(err.Error(), "results differ between runs: count") {
+		t.Errorf("VerifyIdempotent() = %v, want count to differ", err)
+	}
+
+	e = engine.New(counter(true))
+	e.SetOutput(io.Discard)
+	if err := e.VerifyIdempotent(); err != nil {
+		t.Errorf("VerifyIdempotent() with count NonDeterministic = %v", err)
+	}
+	// The engine keeps the second run's results
+	if got := e.Results()["count"].Data; got != calls.Load() {
+		t.Errorf("count = %v, want the second run's %d", got, calls.Load())
+	}
+}
+
+func TestWalk(t *testing.T) {
+	e := engine.New(diamond())
+
+	var visited []string
+	err := e.Walk(func(id string, node engine.Node, depth int) error {
+		if node.ID != id {
+			t.Errorf("Walk passed node %s for id %s", node.ID, id)
+		}
+		visited = append(visited, fmt.Sprintf("%s@%d", id, depth))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a@0", "b@1", "c@1", "d@2"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk visited %v, want %v", visited, want)
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = e.Walk(func(id string, _ engine.Node, _ int) error {
+		visited = append(visited, id)
+		if id == "b" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Walk() = %v, want the callback's error", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk visited %v after stopping, want %v", visited, want)
+	}
+}
+
+func TestOverrideRun(t *testing.T) {
+	e := engine.New(diamond())
+	err := e.OverrideRun("b", func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+		return engine.Result{ID: "b", Data: "stub"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotB any
+	if err := e.OverrideRun("d", func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+		gotB = deps["b"].Data
+		return engine.Result{ID: "d"}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["b"].Data != "stub" || gotB != "stub" {
+		t.Errorf("b = %v, d saw %v, want the stub's output", results["b"].Data, gotB)
+	}
+	if results["c"].Data != 3 {
+		t.Errorf("c = %v, want the real node's output", results["c"].Data)
+	}
+
+	if err := e.OverrideRun("missing", nil); err == nil || err.Error() != "unknown node: missing" {
+		t.Errorf("OverrideRun(missing) = %v, want unknown node", err)
+	}
+}
+
+func TestStrictMissingResult(t *testing.T) {
+	// A cache entry written while b was a fan-out node that emitted nothing
+	// leaves b without a result once it is a plain node reusing that entry
+	cache := engine.NewResultCache()
+	key := func(map[string]engine.Result) string { return "k" }
+	fanOut := engine.New(map[string]engine.Node{
+		"b": {ID: "b", CacheKey: key, CacheTTL: time.Hour, RunMulti: func(ctx context.Context, _ map[string]engine.Result) ([]engine.Result, error) {
+			return nil, nil
+		}},
+	})
+	fanOut.SetCache(cache)
+	if _, err := enginetest.RunAndCollect(fanOut); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := map[string]engine.Node{"b": constNode("b", 2)}
+	b := nodes["b"]
+	b.CacheKey, b.CacheTTL = key, time.Hour
+	nodes["b"] = b
+
+	e := engine.New(nodes)
+	e.SetCache(cache)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Errorf("non-strict run failed: %v", err)
+	}
+
+	e = engine.New(nodes)
+	e.SetCache(cache)
+	e.SetStrict(true)
+	_, err := enginetest.RunAndCollect(e)
+	if err == nil || !strings.Contains(err.Error(), "node b completed without storing a result") {
+		t.Errorf("Run() error = %v, want b's missing result reported", err)
+	}
+}
+
+func TestGraphMetrics(t *testing.T) {
+	want := engine.GraphMetrics{Nodes: 4, Edges: 4, MaxDepth: 3, MaxWidth: 2, AvgFanIn: 1, AvgFanOut: 1}
+	if got := engine.New(diamond()).Metrics(); got != want {
+		t.Errorf("Metrics() = %+v, want %+v", got, want)
+	}
+
+	// Depth and width describe the same levels, which an After edge adds to
+	nodes := diamond()
+	c := nodes["c"]
+	c.After = []string{"b"}
+	nodes["c"] = c
+	want = engine.GraphMetrics{Nodes: 4, Edges: 4, MaxDepth: 4, MaxWidth: 1, AvgFanIn: 1, AvgFanOut: 1}
+	if got := engine.New(nodes).Metrics(); got != want {
+		t.Errorf("Metrics() with c after b = %+v, want %+v", got, want)
+	}
+
+	// A cycle has no levels, so its depth and width are unknown
+	cyclic := engine.New(map[string]engine.Node{
+		"a": constNode("a", 1, "b"),
+		"b": constNode("b", 2, "a"),
+	})
+	if got := cyclic.Metrics(); got.Edges != 2 || got.MaxDepth != 0 || got.MaxWidth != 0 {
+		t.Errorf("Metrics() of a cycle = %+v, want 2 edges and no depth or width", got)
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	startOrder := func(seed int64) []string {
+		var mu sync.Mutex
+		var order []string
+		nodes := make(map[string]engine.Node)
+		for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+			nodes[id] = engine.Node{ID: id, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+				mu.Lock()
+				order = append(order, id)
+				mu.Unlock()
+				return engine.Result{ID: id}, nil
+			}}
+		}
+		e := engine.New(nodes, engine.WithReadyScheduler()).WithSeed(seed)
+		e.SetOutput(io.Discard)
+		e.SetMaxParallelism(1)
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return order
+	}
+
+	// Without a seed nodes that are ready together start by ID
+	if got, want := startOrder(0), []string{"a", "b", "c", "d", "e", "f"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("start order = %v, want %v", got, want)
+	}
+
+	first := startOrder(42)
+	if again := startOrder(42); !reflect.DeepEqual(again, first) {
+		t.Errorf("start order with the same seed = %v, then %v", first, again)
+	}
+	if other := startOrder(7); reflect.DeepEqual(other, first) {
+		t.Errorf("seeds 42 and 7 both start nodes in order %v", first)
+	}
+}
+
+func TestConditionalDepsRunTwice(t *testing.T) {
+	// a reports 1 on the first run and 2 on the second
+	var runs atomic.Int64
+	nodes := diamond()
+	nodes["a"] = engine.Node{ID: "a", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+		return engine.Result{ID: "a", Data: int(runs.Add(1))}, nil
+	}}
+	b := nodes["b"]
+	b.ConditionalDeps = map[string]func(engine.Result) bool{
+		"a": func(r engine.Result) bool { return r.Data != 1 },
+	}
+	nodes["b"] = b
+
+	e := engine.New(nodes)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Skipped()) != 2 {
+		t.Fatalf("skipped = %v, want b and d", e.Skipped())
+	}
+
+	// The second run's skips depend only on the second run's results
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Skipped(); len(got) != 0 {
+		t.Errorf("skipped = %v on the second run, want none", got)
+	}
+	if results["d"].Data != 4 {
+		t.Errorf("d = %v, want 4", results["d"].Data)
+	}
+}
+
+func TestBestEffortRunTwice(t *testing.T) {
+	// a is slow on the first run only
+	var runs atomic.Int64
+	e := engine.New(map[string]engine.Node{
+		"a": {ID: "a", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			if runs.Add(1) == 1 {
+				<-ctx.Done()
+				return engine.Result{}, ctx.Err()
+			}
+			return engine.Result{ID: "a", Data: 1}, nil
+		}},
+	})
+	e.BestEffort(20 * time.Millisecond)
+	if _, err := enginetest.RunAndCollect(e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.TimedOut(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Fatalf("TimedOut() = %v, want [a]", got)
+	}
+
+	results, err := enginetest.RunAndCollect(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["a"].Data != 1 {
+		t.Errorf("a = %v on the second run, want 1", results["a"].Data)
+	}
+	if got := e.TimedOut(); len(got) != 0 {
+		t.Errorf("TimedOut() = %v on the second run, want none", got)
+	}
+}
+
+func TestRunNode(t *testing.T) {
+	e := engine.New(diamond())
+	e.SetOutput(io.Discard)
+
+	if _, err := e.RunNode("d"); err == nil || err.Error() != "node d is missing dependency results: b, c" {
+		t.Errorf("RunNode(d) before any run = %v, want b and c missing", err)
+	}
+	if _, err := e.RunNode("x"); err == nil || err.Error() != "unknown node: x" {
+		t.Errorf("RunNode(x) = %v, want unknown node", err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := e.RunNode(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := e.RunNode("d"); err == nil || err.Error() != "node d is missing dependency results: c" {
+		t.Errorf("RunNode(d) without c = %v, want c missing", err)
+	}
+	if _, ok := e.Results()["c"]; ok {
+		t.Error("RunNode ran the missing dependency c")
+	}
+}
@@ -0,0 +1,50 @@
+// Package enginetest provides helpers for testing nodes and engines.
+package enginetest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
+
+// FakeDeps builds the deps map a node's run function receives, keyed by each
+// result's ID.
+//
+//	deps := enginetest.FakeDeps(engine.Result{ID: node1.ID, Data: node1.Output{Message: "hi"}})
+func FakeDeps(results ...engine.Result) map[string]engine.Result {
+	deps := make(map[string]engine.Result, len(results))
+	for _, result := range results {
+		deps[result.ID] = result
+	}
+	return deps
+}
+
+// AssertLevels fails the test if the engine's execution levels differ from want.
+// Levels are sorted by ID, so want should be too.
+func AssertLevels(t testing.TB, e *engine.Engine, want [][]string) {
+	t.Helper()
+
+	got, err := e.Levels()
+	if err != nil {
+		t.Fatalf("computing levels: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("levels mismatch\n got: %v\nwant: %v", got, want)
+	}
+}
+
+// RunAndCollect runs the engine with its output captured in memory instead of
+// printed, and returns the results. On failure the captured output is included
+// in the error to help debugging.
+func RunAndCollect(e *engine.Engine) (map[string]engine.Result, error) {
+	var out bytes.Buffer
+	e.SetOutput(&out)
+
+	if err := e.Run(); err != nil {
+		return e.Results(), fmt.Errorf("%w\noutput:\n%s", err, out.String())
+	}
+	return e.Results(), nil
+}
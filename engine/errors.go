@@ -0,0 +1,60 @@
+package engine
+
+import "fmt"
+
+// NodeError is the error a run returns when a node fails. Its message comes
+// from the engine's error formatter (see SetErrorFormatter); errors.Is and
+// errors.As see through it to the node's own error.
+type NodeError struct {
+	Node string
+	Err  error
+
+	format func(nodeID string, err error) string
+}
+
+func (e *NodeError) Error() string {
+	if e.format != nil {
+		return e.format(e.Node, e.Err)
+	}
+	return defaultErrorFormatter(e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// defaultErrorFormatter renders a failure as "node <id> failed: <err>"
+func defaultErrorFormatter(nodeID string, err error) string {
+	return fmt.Sprintf("node %s failed: %v", nodeID, err)
+}
+
+// SetErrorFormatter controls how node failures render wherever the run's
+// error is printed, e.g. in logs and HTTP responses: stripping stack traces
+// in production but keeping them in development. A nil formatter restores the
+// default, "node <id> failed: <err>".
+func (e *Engine) SetErrorFormatter(format func(nodeID string, err error) string) {
+	e.errorFormatter = format
+}
+
+// nodeError wraps a node's failure for the engine's formatter
+func (e *Engine) nodeError(nodeID string, err error) error {
+	return &NodeError{Node: nodeID, Err: err, format: e.errorFormatter}
+}
+
+// PanicError is the error of a node that panicked. The panic is recovered so
+// the rest of the process keeps running; the message carries the panic value
+// and the stack trace of the goroutine that panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
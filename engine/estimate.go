@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+)
+
+// EstimatedDuration estimates how long a run takes from the nodes' Cost hints:
+// the critical path, the most expensive chain of nodes each waiting for the
+// one before it through DependsOn or After. It assumes every node starts as
+// soon as those have finished, as with WithReadyScheduler, and counts nodes
+// without a Cost as free, so treat it as a lower bound. The level scheduler
+// can take longer, since each level also waits for its slowest node.
+func (e *Engine) EstimatedDuration() (time.Duration, error) {
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return 0, err
+	}
+
+	// finish is the estimated time each planned node completes; seeded nodes
+	// aren't planned and are ready from the start
+	finish := make(map[string]time.Duration)
+	var total time.Duration
+	for _, level := range levels {
+		for _, id := range level {
+			node := e.nodes[id]
+			var start time.Duration
+			for producer := range e.producersOf(node) {
+				start = max(start, finish[producer])
+			}
+			for after := range e.afterOf(node) {
+				start = max(start, finish[after])
+			}
+			finish[id] = start + node.Cost
+			total = max(total, finish[id])
+		}
+	}
+	return total, nil
+}
+
+// CheckDeadline reports up front whether a run can finish within deadline,
+// e.g. before RunWithDeadline, returning an error such as "graph is estimated
+// to take 40s but the deadline is 30s" when EstimatedDuration exceeds it.
+func (e *Engine) CheckDeadline(deadline time.Duration) error {
+	estimate, err := e.EstimatedDuration()
+	if err != nil {
+		return err
+	}
+	if estimate > deadline {
+		return fmt.Errorf("graph is estimated to take %s but the deadline is %s", estimate, deadline)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// eventKind names what happened in an event
+type eventKind string
+
+const (
+	eventLevelStarted   eventKind = "level_started"
+	eventLevelCompleted eventKind = "level_completed"
+	eventStarted        eventKind = "started"
+	eventCompleted      eventKind = "completed"
+	eventError          eventKind = "error"
+	eventHalted         eventKind = "halted"
+	eventSkipped        eventKind = "skipped"
+	eventTimedOut       eventKind = "timed_out"
+)
+
+// event describes a step of a run. Level events carry Level and Nodes, node
+// events carry Node and, once it finished, Duration, Err or Reason. Completed
+// events also carry the results the node stored.
+type event struct {
+	Kind     eventKind
+	RunID    string
+	Level    int
+	Nodes    []string
+	Node     string
+	Duration time.Duration
+	Cached   bool
+	Reason   string
+	Err      error
+	Results  map[string]Result
+	Time     time.Time
+}
+
+// emit stamps ev with the run ID from ctx and the current time and hands it to
+// every listener, the engine's and the run's (see withListener). Listeners are
+// called synchronously from the goroutine that ran the node, so they must be
+// safe for concurrent use.
+func (e *Engine) emit(ctx context.Context, ev event) {
+	runListener, _ := ctx.Value(listenerKey).(func(event))
+	if len(e.listeners) == 0 && runListener == nil {
+		return
+	}
+	ev.RunID, _ = RunID(ctx)
+	ev.Time = time.Now()
+	for _, listen := range e.listeners {
+		listen(ev)
+	}
+	if runListener != nil {
+		runListener(ev)
+	}
+}
+
+// withListener returns a context whose run also emits its events to listen,
+// for a listener scoped to one run rather than registered on the engine
+func withListener(ctx context.Context, listen func(event)) context.Context {
+	return context.WithValue(ctx, listenerKey, listen)
+}
+
+// WithJSONLogs writes one JSON object per line to w for every node and level
+// event of a run, for ingestion by log aggregators, e.g.
+//
+//	{"duration_ms":12,"event":"completed","node":"node3","run_id":"...","time":"..."}
+//
+// Node events are started, completed, error, halted, skipped and timed_out;
+// levels emit level_started and level_completed. A node returning ErrHalt logs
+// halted, not error, since it stops the run successfully. It complements the human-readable output
+// set with SetOutput and returns the engine for chaining.
+func (e *Engine) WithJSONLogs(w io.Writer) *Engine {
+	enc := json.NewEncoder(&syncWriter{w: w})
+	e.listeners = append(e.listeners, func(ev event) {
+		enc.Encode(ev.jsonFields())
+	})
+	return e
+}
+
+// jsonFields returns the event as the object written by WithJSONLogs
+func (ev event) jsonFields() map[string]any {
+	fields := map[string]any{
+		"event": ev.Kind,
+		"time":  ev.Time.Format(time.RFC3339Nano),
+	}
+	if ev.RunID != "" {
+		fields["run_id"] = ev.RunID
+	}
+
+	switch ev.Kind {
+	case eventLevelStarted, eventLevelCompleted:
+		fields["level"] = ev.Level
+		fields["nodes"] = ev.Nodes
+	default:
+		fields["node"] = ev.Node
+	}
+
+	switch ev.Kind {
+	case eventCompleted, eventHalted:
+		fields["duration_ms"] = ev.Duration.Milliseconds()
+		if ev.Cached {
+			fields["cached"] = true
+		}
+	case eventError:
+		fields["duration_ms"] = ev.Duration.Milliseconds()
+		fields["error"] = ev.Err.Error()
+	case eventSkipped:
+		fields["reason"] = ev.Reason
+	case eventTimedOut:
+		fields["duration_ms"] = ev.Duration.Milliseconds()
+	}
+	return fields
+}
@@ -0,0 +1,13 @@
+package engine
+
+import "time"
+
+// SetScheduleGate exposes setScheduleGate to the engine_test package
+func SetScheduleGate(e *Engine, gate func(nodeID string) <-chan struct{}) {
+	e.setScheduleGate(gate)
+}
+
+// RetryDelay exposes RetryPolicy.delay to the engine_test package
+func RetryDelay(p RetryPolicy, attempt int) time.Duration {
+	return p.delay(attempt)
+}
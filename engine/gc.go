@@ -0,0 +1,104 @@
+package engine
+
+import "strings"
+
+// EnableResultGC makes Run drop a node's result as soon as every node that
+// depends on it has run, reducing peak memory for very large graphs where
+// results would otherwise live until Run returns. Results of nodes without
+// dependents, and of the targets of a BuildFor engine, are kept so the final
+// outputs remain available. Only enable it when you won't need every
+// intermediate result from Results after the run.
+func (e *Engine) EnableResultGC() {
+	e.resultGC = true
+}
+
+// startResultGC counts the dependents of every node for a run
+func (e *Engine) startResultGC() {
+	if !e.resultGC {
+		return
+	}
+
+	keep := make(map[string]bool, len(e.targets))
+	for _, id := range e.targets {
+		if producer, ok := producerOf(e.nodes, id); ok {
+			keep[producer] = true
+		}
+	}
+
+	remaining := make(map[string]int)
+	for _, node := range e.nodes {
+		for producer := range e.producersOf(node) {
+			remaining[producer]++
+		}
+	}
+	for id := range keep {
+		delete(remaining, id)
+	}
+
+	e.mu.Lock()
+	e.gcRemaining = remaining
+	e.collected = make(map[string]bool)
+	e.mu.Unlock()
+}
+
+// stopResultGC disables collection once a run is over
+func (e *Engine) stopResultGC() {
+	e.mu.Lock()
+	e.gcRemaining = nil
+	e.mu.Unlock()
+}
+
+// releaseDeps records that node no longer needs its dependencies' results and
+// drops the ones nothing else is waiting for.
+func (e *Engine) releaseDeps(node Node) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.gcRemaining == nil {
+		return
+	}
+	for producer := range e.producersOf(node) {
+		count, tracked := e.gcRemaining[producer]
+		if !tracked {
+			continue
+		}
+		if count > 1 {
+			e.gcRemaining[producer] = count - 1
+			continue
+		}
+
+		delete(e.gcRemaining, producer)
+		delete(e.results, producer)
+		e.collected[producer] = true
+		if e.nodes[producer].RunMulti != nil {
+			for id := range e.results {
+				if strings.HasPrefix(id, producer+SubIDSeparator) {
+					delete(e.results, id)
+				}
+			}
+		}
+	}
+}
+
+// producersOf returns the distinct nodes in the engine that node depends on
+func (e *Engine) producersOf(node Node) map[string]bool {
+	producers := make(map[string]bool, len(node.DependsOn))
+	for _, dep := range node.DependsOn {
+		if producer, ok := producerOf(e.nodes, dep); ok {
+			producers[producer] = true
+		}
+	}
+	return producers
+}
+
+// afterOf returns the nodes in the engine that node must run after because of
+// its After list
+func (e *Engine) afterOf(node Node) map[string]bool {
+	after := make(map[string]bool, len(node.After))
+	for _, ref := range node.After {
+		if producer, ok := producerOf(e.nodes, ref); ok {
+			after[producer] = true
+		}
+	}
+	return after
+}
@@ -0,0 +1,3 @@
+module github.com/grindlemire/graph-builder/engine
+
+go 1.25.1
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// group runs the nodes of one level, like errgroup.Group: the first node error
+// cancels the context handed to its siblings so in-flight work stops early,
+// and Wait reports that error. ErrHalt is not a failure; it is recorded
+// without canceling siblings so they can finish.
+type group struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// sem bounds the number of in-flight nodes when the level has a limit
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	err    error
+	halted bool
+
+	// failFast makes Wait return on the first error instead of waiting for
+	// the canceled siblings to return
+	failFast bool
+}
+
+// newGroup returns a group deriving its context from ctx and running at most
+// limit functions at once; zero means unlimited
+func newGroup(ctx context.Context, limit int) *group {
+	g := &group{parent: ctx}
+	g.ctx, g.cancel = context.WithCancelCause(ctx)
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// Go starts f once a slot is free. It returns false without starting f if the
+// group's context is done, either because a sibling failed or the parent was
+// canceled.
+func (g *group) Go(f func(ctx context.Context) error) bool {
+	if g.ctx.Err() != nil {
+		return false
+	}
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.ctx.Done():
+			return false
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+
+		err := f(g.ctx)
+		if err == nil {
+			return
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if errors.Is(err, ErrHalt) {
+			g.halted = true
+			return
+		}
+		if g.err == nil {
+			g.err = err
+			g.cancel(err)
+		}
+	}()
+	return true
+}
+
+// Wait blocks until every function started so far returned and reports the
+// first error; a failed function cancels the others, which are still awaited.
+// If the parent context is done first it returns right away with the
+// parent's error, leaving the canceled functions to wind down. With failFast
+// it likewise returns as soon as a function failed.
+func (g *group) Wait() error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	var failed <-chan struct{}
+	if g.failFast {
+		failed = g.ctx.Done()
+	}
+	select {
+	case <-done:
+	case <-failed:
+	case <-g.parent.Done():
+		return g.parent.Err()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Err returns the first error without waiting
+func (g *group) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Halted reports whether a function returned ErrHalt
+func (g *group) Halted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.halted
+}
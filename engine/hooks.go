@@ -0,0 +1,41 @@
+package engine
+
+import "time"
+
+// OnNodeStart registers fn to be called whenever a node starts running, e.g.
+// to log or count it without touching the node's Run. Hooks are called
+// synchronously from the goroutine running the node, so they must be quick
+// and safe for concurrent use. It returns the engine for chaining.
+func (e *Engine) OnNodeStart(fn func(nodeID string)) *Engine {
+	e.listeners = append(e.listeners, func(ev event) {
+		if ev.Kind == eventStarted {
+			fn(ev.Node)
+		}
+	})
+	return e
+}
+
+// OnNodeSuccess registers fn to be called whenever a node completes, with its
+// own result and how long it ran. A result reused from the cache reports a
+// zero duration. Like OnNodeStart it must be safe for concurrent use.
+func (e *Engine) OnNodeSuccess(fn func(nodeID string, res Result, elapsed time.Duration)) *Engine {
+	e.listeners = append(e.listeners, func(ev event) {
+		if ev.Kind == eventCompleted {
+			fn(ev.Node, ev.Results[ev.Node], ev.Duration)
+		}
+	})
+	return e
+}
+
+// OnNodeError registers fn to be called whenever a node fails, with the
+// error that failed it before the run wraps it, e.g. to raise an alert.
+// Skipped, timed-out and halting nodes aren't failures. Like OnNodeStart it
+// must be safe for concurrent use.
+func (e *Engine) OnNodeError(fn func(nodeID string, err error, elapsed time.Duration)) *Engine {
+	e.listeners = append(e.listeners, func(ev event) {
+		if ev.Kind == eventError {
+			fn(ev.Node, ev.Err, ev.Duration)
+		}
+	})
+	return e
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// InputSpec declares a typed input of a node, see Node.Inputs
+type InputSpec struct {
+	ID string
+
+	// TypeCheck reports whether the dependency's result has the expected type
+	TypeCheck func(Result) error
+}
+
+// Input declares that a node reads the output of node id as a T
+func Input[T any](id string) InputSpec {
+	return InputSpec{
+		ID: id,
+		TypeCheck: func(r Result) error {
+			_, err := DataAs[T](id, r)
+			return err
+		},
+	}
+}
+
+// Value returns the output of a dependency declared with Input[T]. The engine
+// checked it before calling Run, so there is no error to handle; it returns
+// the zero value if id wasn't declared as an input of type T.
+func Value[T any](deps map[string]Result, id string) T {
+	data, _ := DataAs[T](id, deps[id])
+	return data
+}
+
+// checkInputs verifies every declared input is present with the expected type
+func (n Node) checkInputs(deps map[string]Result) error {
+	for _, in := range n.Inputs {
+		result, ok := deps[in.ID]
+		if !ok {
+			return fmt.Errorf("input %s not found in deps", in.ID)
+		}
+		if in.TypeCheck != nil {
+			if err := in.TypeCheck(result); err != nil {
+				return fmt.Errorf("input %s: %w", in.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// withInputDeps returns the node with every input ID in DependsOn
+func (n Node) withInputDeps() Node {
+	var missing []string
+	for _, in := range n.Inputs {
+		if !slices.Contains(n.DependsOn, in.ID) && !slices.Contains(missing, in.ID) {
+			missing = append(missing, in.ID)
+		}
+	}
+	if len(missing) > 0 {
+		n.DependsOn = append(slices.Clone(n.DependsOn), missing...)
+	}
+	return n
+}
+
+// NewNode wraps a strongly typed function into a Node, for simple nodes that
+// don't need an output.go: the single dependency's output is handed to fn as
+// an I, checked like an Input, and fn's O is boxed into Result.Data, e.g.
+//
+//	engine.NewNode("node2c", []string{node1.ID},
+//		func(ctx context.Context, in node1.Output) (string, error) { ... })
+//
+// With no dependencies fn receives the zero I. It panics if given more than
+// one dependency, since I can only come from one.
+func NewNode[I, O any](id string, deps []string, fn func(ctx context.Context, in I) (O, error)) Node {
+	if len(deps) > 1 {
+		panic(fmt.Sprintf("engine.NewNode %s: at most one dependency is supported, got %v", id, deps))
+	}
+
+	node := Node{ID: id, DependsOn: slices.Clone(deps)}
+	var input string
+	if len(deps) == 1 {
+		input, _ = SplitVersion(deps[0])
+		node.Inputs = []InputSpec{Input[I](input)}
+	}
+	node.Run = func(ctx context.Context, deps map[string]Result) (Result, error) {
+		var in I
+		if input != "" {
+			in = Value[I](deps, input)
+		}
+		out, err := fn(ctx, in)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{ID: id, Data: out}, nil
+	}
+	return node
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// WithLogger reports every node and level event of a run as a structured
+// record on l instead of the decorative output, so production deployments get
+// JSON logs and log levels from the slog handler they configure:
+//
+//	engine.New(registry, engine.WithLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+//
+// Records carry the fields WithJSONLogs writes, with the event as the message
+// and a level's index as graph_level.
+// Node and level starts log at Debug, completions, skips and halts at Info,
+// timeouts at Warn and failures at Error. The engine's output is discarded, including
+// what nodes print with Printf; call SetOutput afterwards to keep it.
+func WithLogger(l *slog.Logger) Option {
+	return func(e *Engine) {
+		e.SetOutput(io.Discard)
+		e.listeners = append(e.listeners, func(ev event) {
+			level := ev.logLevel()
+			if !l.Enabled(context.Background(), level) {
+				return
+			}
+			fields := ev.jsonFields()
+			delete(fields, "event")
+			delete(fields, "time")
+			// slog uses level for the record's severity
+			if level, ok := fields["level"]; ok {
+				fields["graph_level"] = level
+				delete(fields, "level")
+			}
+			attrs := make([]slog.Attr, 0, len(fields))
+			for _, key := range slices.Sorted(maps.Keys(fields)) {
+				attrs = append(attrs, slog.Any(key, fields[key]))
+			}
+			l.LogAttrs(context.Background(), level, string(ev.Kind), attrs...)
+		})
+	}
+}
+
+// logLevel is the slog level WithLogger records the event at
+func (ev event) logLevel() slog.Level {
+	switch ev.Kind {
+	case eventError:
+		return slog.LevelError
+	case eventTimedOut:
+		return slog.LevelWarn
+	case eventCompleted, eventSkipped, eventHalted:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
@@ -0,0 +1,37 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// MergeResults combines the results of separately run engines, e.g. the
+// independent subgraphs of a big graph run on different machines, into one
+// result set. An ID present in several engines is fine as long as its Data is
+// equal in all of them, as for a shared upstream node; otherwise the runs are
+// incompatible and the error lists every colliding ID.
+func MergeResults(engines ...*Engine) (map[string]Result, error) {
+	merged := make(map[string]Result)
+	var collisions []string
+	for _, e := range engines {
+		for id, result := range e.Results() {
+			prev, exists := merged[id]
+			if !exists {
+				merged[id] = result
+				continue
+			}
+			if !reflect.DeepEqual(prev.Data, result.Data) && !slices.Contains(collisions, id) {
+				collisions = append(collisions, id)
+			}
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("results differ between engines for: %s", strings.Join(collisions, ", "))
+	}
+	return merged, nil
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// MetricsCollector receives measurements of the engine's runs, to be exported
+// to a monitoring system such as Prometheus. Its methods are called from the
+// goroutines running nodes, so they must be safe for concurrent use.
+type MetricsCollector interface {
+	// RunStarted counts a run of graph: the name set with SetGraphName, else
+	// the engine's distinct Builder targets joined by commas, or "all" for an
+	// engine built with New
+	RunStarted(graph string)
+	// NodeCompleted observes how long a node ran; cached results aren't
+	// observed
+	NodeCompleted(nodeID string, elapsed time.Duration)
+	// NodeFailed counts a node failure. A node returning ErrHalt stops the
+	// run successfully and isn't counted.
+	NodeFailed(nodeID string)
+	// LevelStarted observes how many nodes a level runs at once. The ready
+	// scheduler (WithReadyScheduler) has no levels and doesn't report it.
+	LevelStarted(level, nodes int)
+}
+
+// WithMetrics reports every run to c
+func WithMetrics(c MetricsCollector) Option {
+	return func(e *Engine) {
+		e.metrics = c
+		e.listeners = append(e.listeners, func(ev event) {
+			switch ev.Kind {
+			case eventCompleted:
+				if !ev.Cached {
+					c.NodeCompleted(ev.Node, ev.Duration)
+				}
+			case eventError:
+				c.NodeFailed(ev.Node)
+			case eventLevelStarted:
+				c.LevelStarted(ev.Level, len(ev.Nodes))
+			}
+		})
+	}
+}
+
+// SetGraphName sets the graph label of the engine's runs reported to its
+// MetricsCollector. Engines built for caller-supplied targets should use a
+// fixed name, e.g. the endpoint's, so that clients can't create an unbounded
+// number of metric series.
+func (e *Engine) SetGraphName(name string) {
+	e.graphLabel = name
+}
+
+// graphName labels the engine's runs for metrics
+func (e *Engine) graphName() string {
+	if e.graphLabel != "" {
+		return e.graphLabel
+	}
+	if len(e.targets) == 0 {
+		return "all"
+	}
+	return strings.Join(slices.Compact(slices.Sorted(slices.Values(e.targets))), ",")
+}
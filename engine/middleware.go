@@ -0,0 +1,45 @@
+package engine
+
+// Middleware wraps a node's RunFunc, like HTTP middleware wraps a handler, to
+// apply timing, auth checks or tracing uniformly to every node. The node's ID
+// is available from ctx with NodeID:
+//
+//	func timing(next engine.RunFunc) engine.RunFunc {
+//		return func(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
+//			start := time.Now()
+//			defer func() {
+//				id, _ := engine.NodeID(ctx)
+//				log.Printf("%s took %s", id, time.Since(start))
+//			}()
+//			return next(ctx, deps)
+//		}
+//	}
+type Middleware func(next RunFunc) RunFunc
+
+// Use adds middleware around the Run of every node the engine executes. The
+// first middleware is the outermost; each retry attempt goes through the
+// whole chain. Fan-out nodes using RunMulti aren't wrapped, since their
+// function has a different signature.
+func (e *Engine) Use(mw ...Middleware) {
+	e.middleware = append(e.middleware, mw...)
+}
+
+// WithMiddleware is the Option form of Use, e.g. to wrap the nodes of every
+// engine a Builder creates
+func WithMiddleware(mw ...Middleware) Option {
+	return func(e *Engine) {
+		e.Use(mw...)
+	}
+}
+
+// withMiddleware returns the node with its Run wrapped in the engine's
+// middleware
+func (e *Engine) withMiddleware(node Node) Node {
+	if node.Run == nil {
+		return node
+	}
+	for i := len(e.middleware) - 1; i >= 0; i-- {
+		node.Run = e.middleware[i](node.Run)
+	}
+	return node
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Execution records when a node's Run ran during a run
+type Execution struct {
+	ID    string
+	Level int
+	Start time.Time
+	End   time.Time
+}
+
+// ExecutionOrder returns the IDs of the nodes whose Run returned in the last
+// run, in the order they completed. Nodes of one level complete in any order,
+// so tests should assert happens-before relationships with Executions rather
+// than compare the exact sequence. Skipped, cached and seeded nodes don't
+// appear.
+func (e *Engine) ExecutionOrder() []string {
+	executions := e.Executions()
+	order := make([]string, len(executions))
+	for i, ex := range executions {
+		order[i] = ex.ID
+	}
+	return order
+}
+
+// Executions returns the level and the start and end time of every node whose
+// Run returned in the last run, in completion order, e.g. to check that node3
+// only started after node2a, node2b and node2c had ended.
+func (e *Engine) Executions() []Execution {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return slices.Clone(e.executions)
+}
+
+// TimelineEntry is one bar of a Gantt chart of a run, with offsets in
+// milliseconds from the start of the run
+type TimelineEntry struct {
+	ID         string  `json:"id"`
+	Level      int     `json:"level"`
+	StartMS    float64 `json:"start_ms"`
+	EndMS      float64 `json:"end_ms"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// TimelineJSON returns the last run's Executions as a JSON array of
+// TimelineEntry sorted by start, ready to render as a Gantt chart that shows
+// whether a level really ran in parallel and which nodes were on the
+// critical path.
+func (e *Engine) TimelineJSON() []byte {
+	e.mu.RLock()
+	start := e.runStart
+	e.mu.RUnlock()
+
+	timeline := []TimelineEntry{}
+	for _, ex := range e.Executions() {
+		timeline = append(timeline, TimelineEntry{
+			ID:         ex.ID,
+			Level:      ex.Level,
+			StartMS:    ms(ex.Start.Sub(start)),
+			EndMS:      ms(ex.End.Sub(start)),
+			DurationMS: ms(ex.End.Sub(ex.Start)),
+		})
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].StartMS < timeline[j].StartMS })
+
+	// Marshaling plain strings and numbers can't fail
+	data, _ := json.Marshal(timeline)
+	return data
+}
+
+// ms converts d to fractional milliseconds for JSON
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
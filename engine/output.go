@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type ctxKey int
+
+const (
+	nodeIDKey ctxKey = iota
+	outputKey
+	runIDKey
+	resourcesKey
+	listenerKey
+)
+
+// withNode returns a context carrying the executing node's ID and output writer
+func withNode(ctx context.Context, nodeID string, out io.Writer) context.Context {
+	ctx = context.WithValue(ctx, nodeIDKey, nodeID)
+	return context.WithValue(ctx, outputKey, out)
+}
+
+// NodeID returns the ID of the node whose Run received ctx.
+func NodeID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(nodeIDKey).(string)
+	return id, ok
+}
+
+// withRunID returns a context carrying the ID of the run
+func withRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey, runID)
+}
+
+// RunID returns the ID of the run that called the node with ctx, for
+// correlating a node's own logs with the engine's.
+func RunID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(runIDKey).(string)
+	return id, ok
+}
+
+// newRunID returns a random (version 4) UUID
+func newRunID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Output returns the writer a node should print to. It respects the engine's
+// SetOutput and BufferNodeOutput settings, and falls back to os.Stdout when ctx
+// didn't come from the engine (e.g. when calling a run function in a test).
+func Output(ctx context.Context) io.Writer {
+	if out, ok := ctx.Value(outputKey).(io.Writer); ok {
+		return out
+	}
+	return os.Stdout
+}
+
+// Printf formats to the node's output. Nodes should use it instead of
+// fmt.Printf so their lines can be redirected and buffered by the engine.
+func Printf(ctx context.Context, format string, args ...any) {
+	fmt.Fprintf(Output(ctx), format, args...)
+}
+
+// syncWriter serializes writes so concurrently running nodes can share one writer
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
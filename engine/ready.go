@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// WithReadyScheduler starts each node as soon as the nodes it depends on (or
+// runs After) have finished, instead of level by level. A fast chain then no
+// longer waits for a slow node in an earlier level that it doesn't depend on,
+// which shortens runs of unbalanced graphs.
+//
+// Results still record the node's level. The per-level knobs don't apply:
+// SetLevelParallelism and BestEffort's level deadline are ignored, and no
+// level events are emitted. SetMaxParallelism bounds the nodes in flight
+// across the whole graph, and an Exclusive node waits for every running node
+// to finish and blocks the others until it is done.
+func WithReadyScheduler() Option {
+	return func(e *Engine) {
+		e.readyScheduler = true
+	}
+}
+
+// runReady executes the nodes of levels as their dependencies finish. It
+// reports whether a node halted the run.
+func (e *Engine) runReady(ctx context.Context, levels [][]string) (bool, error) {
+	levelOf := make(map[string]int)
+	for level, ids := range levels {
+		for _, id := range ids {
+			levelOf[id] = level
+		}
+	}
+
+	// pending counts the unfinished producers of each node; seeded producers
+	// are not part of the plan and count as finished
+	pending := make(map[string]int, len(levelOf))
+	dependents := make(map[string][]string, len(levelOf))
+	var ready []string
+	for _, id := range slices.Concat(levels...) {
+		node := e.nodes[id]
+		producers := e.producersOf(node)
+		for after := range e.afterOf(node) {
+			producers[after] = true
+		}
+		for producer := range producers {
+			if _, ok := levelOf[producer]; ok {
+				pending[id]++
+				dependents[producer] = append(dependents[producer], id)
+			}
+		}
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	// finish releases the dependents of id. Skipped and failed nodes release
+	// theirs too; runNode then skips them because of the missing result.
+	unfinished := idSet(levelOf)
+	finish := func(id string) {
+		delete(unfinished, id)
+		for _, dependent := range dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	var rng *rand.Rand
+	if e.seed != 0 {
+		rng = rand.New(rand.NewPCG(uint64(e.seed), 0))
+	}
+
+	g := newGroup(ctx, e.maxParallelism)
+	g.failFast = e.failFast
+	defer g.cancel(nil)
+
+	// Exclusive nodes take the write side, so they run alone
+	var exclusive sync.RWMutex
+	// done is buffered for every node so a finishing node never blocks on the
+	// coordinator while it waits for a free slot in g.Go
+	done := make(chan string, len(levelOf))
+	running := 0
+	for {
+		for len(ready) > 0 && g.ctx.Err() == nil && !g.Halted() {
+			batch := e.readyOrder(ready, rng)
+			ready = nil
+			for _, id := range batch {
+				if e.rerun != nil && !e.rerun[id] {
+					finish(id)
+					continue
+				}
+				if e.nodes[id].Detached {
+					e.runDetached(ctx, id, levelOf[id])
+					finish(id)
+					continue
+				}
+				started := g.Go(func(ctx context.Context) error {
+					defer func() { done <- id }()
+					if e.nodes[id].Exclusive {
+						exclusive.Lock()
+						defer exclusive.Unlock()
+					} else {
+						exclusive.RLock()
+						defer exclusive.RUnlock()
+					}
+					err := e.runNode(ctx, id, levelOf[id])
+					if err != nil && e.continueOnError && !errors.Is(err, ErrHalt) {
+						e.recordFailure(id, err)
+						return nil
+					}
+					return err
+				})
+				if !started {
+					break
+				}
+				running++
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		var failed <-chan struct{}
+		if e.failFast {
+			failed = g.ctx.Done()
+		}
+		select {
+		case id := <-done:
+			running--
+			finish(id)
+		case <-failed:
+			if ctx.Err() == nil {
+				return false, g.Err()
+			}
+			return false, &InterruptError{Level: lowestLevel(unfinished, levelOf), Err: ctx.Err()}
+		case <-ctx.Done():
+			return false, &InterruptError{Level: lowestLevel(unfinished, levelOf), Err: ctx.Err()}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, &InterruptError{Level: lowestLevel(unfinished, levelOf), Err: err}
+	}
+	if err := g.Err(); err != nil {
+		return false, err
+	}
+	if g.Halted() {
+		e.logf("\n■ Halted\n")
+		return true, nil
+	}
+	return false, nil
+}
+
+// readyOrder orders nodes that became ready together like costOrder, breaking
+// ties by ID or, with a seed, pseudo-randomly
+func (e *Engine) readyOrder(ids []string, rng *rand.Rand) []string {
+	ordered := slices.Clone(ids)
+	slices.Sort(ordered)
+	if rng != nil {
+		rng.Shuffle(len(ordered), func(i, j int) {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		})
+	}
+	return e.costOrder(ordered)
+}
+
+// idSet returns the keys of m as a set
+func idSet[V any](m map[string]V) map[string]bool {
+	set := make(map[string]bool, len(m))
+	for k := range m {
+		set[k] = true
+	}
+	return set
+}
+
+// lowestLevel returns the lowest level among ids, the level an interrupted
+// run had not yet got past
+func lowestLevel(ids map[string]bool, levelOf map[string]int) int {
+	lowest := -1
+	for id := range ids {
+		if level := levelOf[id]; lowest < 0 || level < lowest {
+			lowest = level
+		}
+	}
+	return max(lowest, 0)
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Replay returns an engine with the topology of graph whose nodes, instead of
+// running their real logic, return the canned results, e.g. ones captured from
+// an earlier run with Results. Use it to test downstream consumers
+// deterministically or to demo a graph offline without side effects. A node
+// with no recorded result skips itself with ErrSkip. Nodes keep everything
+// that decides when and whether they run, such as After, ConditionalDeps and
+// Detached; only their own logic, Run or RunMulti with Adapt and Finalize, is
+// replaced.
+func Replay(graph *Engine, results map[string]Result) *Engine {
+	nodes := make(map[string]Node, len(graph.nodes))
+	for id, node := range graph.nodes {
+		replayed := node
+		replayed.Adapt = nil
+		replayed.Finalize = nil
+		if node.RunMulti != nil {
+			replayed.RunMulti = replayMulti(id, results)
+		} else {
+			replayed.Run = replayRun(id, results)
+		}
+		nodes[id] = replayed
+	}
+
+	e := New(nodes)
+	e.targets = append([]string(nil), graph.targets...)
+	return e
+}
+
+func replayRun(id string, results map[string]Result) RunFunc {
+	return func(ctx context.Context, _ map[string]Result) (Result, error) {
+		result, ok := results[id]
+		if !ok {
+			return Result{}, fmt.Errorf("no recorded result: %w", ErrSkip)
+		}
+		return result, nil
+	}
+}
+
+// replayMulti returns the recorded results of a fan-out node, in ID order
+func replayMulti(id string, results map[string]Result) MultiRunFunc {
+	return func(ctx context.Context, _ map[string]Result) ([]Result, error) {
+		var emitted []Result
+		for resultID, result := range results {
+			if resultID == id || strings.HasPrefix(resultID, id+SubIDSeparator) {
+				emitted = append(emitted, result)
+			}
+		}
+		sort.Slice(emitted, func(i, j int) bool { return emitted[i].ID < emitted[j].ID })
+		return emitted, nil
+	}
+}
@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// NodeStatus is how a node's part in a run ended
+type NodeStatus string
+
+const (
+	StatusCompleted NodeStatus = "completed"
+	StatusCached    NodeStatus = "cached"
+	StatusSeeded    NodeStatus = "seeded"
+	StatusFailed    NodeStatus = "failed"
+	StatusCanceled  NodeStatus = "canceled"
+	StatusSkipped   NodeStatus = "skipped"
+	StatusTimedOut  NodeStatus = "timed_out"
+	StatusNotRun    NodeStatus = "not_run"
+)
+
+// ExecutionReport describes a whole run, to return to callers or store for a
+// postmortem. It marshals to JSON as is.
+type ExecutionReport struct {
+	RunID      string       `json:"run_id"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	DurationMS float64      `json:"duration_ms"`
+	Error      string       `json:"error,omitempty"`
+	Nodes      []NodeReport `json:"nodes"`
+}
+
+// NodeReport describes one node of a run. Start and End are only set for
+// nodes whose Run was called.
+type NodeReport struct {
+	ID         string     `json:"id"`
+	Level      int        `json:"level"`
+	Status     NodeStatus `json:"status"`
+	Start      time.Time  `json:"start,omitzero"`
+	End        time.Time  `json:"end,omitzero"`
+	DurationMS float64    `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+	SkipReason string     `json:"skip_reason,omitempty"`
+}
+
+// Report returns the report of the last run, with a NodeReport for every node
+// of the engine sorted by level, then ID. A node failing because a sibling's
+// failure canceled the run is reported as canceled rather than failed.
+func (e *Engine) Report() ExecutionReport {
+	levelOf := make(map[string]int)
+	if levels, err := e.topoSortLevels(); err == nil {
+		for level, ids := range levels {
+			for _, id := range ids {
+				levelOf[id] = level
+			}
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	report := ExecutionReport{
+		RunID: e.runID,
+		Start: e.runStart,
+		End:   e.runEnd,
+		Nodes: make([]NodeReport, 0, len(e.nodes)),
+	}
+	if !e.runEnd.IsZero() {
+		report.DurationMS = ms(e.runEnd.Sub(e.runStart))
+	}
+	if e.runErr != nil {
+		report.Error = e.runErr.Error()
+	}
+
+	executions := make(map[string]Execution, len(e.executions))
+	for _, ex := range e.executions {
+		executions[ex.ID] = ex
+	}
+	for id := range e.nodes {
+		node := NodeReport{ID: id, Level: levelOf[id], Status: StatusNotRun}
+		ex, ran := executions[id]
+		if ran {
+			node.Start, node.End = ex.Start, ex.End
+			node.DurationMS = ms(ex.End.Sub(ex.Start))
+		}
+		_, seeded := e.seeds[id]
+		_, stored := e.results[id]
+
+		err := e.nodeErrors[id]
+		// The node's report already names it, so drop the NodeError prefix
+		var nodeErr *NodeError
+		if errors.As(err, &nodeErr) && nodeErr.Node == id {
+			err = nodeErr.Err
+		}
+		switch {
+		case err != nil && errors.Is(err, context.Canceled):
+			node.Status, node.Error = StatusCanceled, err.Error()
+		case err != nil:
+			node.Status, node.Error = StatusFailed, err.Error()
+		case e.timedOut[id]:
+			node.Status = StatusTimedOut
+		case e.skipped[id] != "":
+			node.Status, node.SkipReason = StatusSkipped, e.skipped[id]
+		case seeded:
+			node.Status = StatusSeeded
+		case ran:
+			node.Status = StatusCompleted
+		case stored || e.finished[id]:
+			node.Status = StatusCached
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool {
+		a, b := report.Nodes[i], report.Nodes[j]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		return a.ID < b.ID
+	})
+	return report
+}
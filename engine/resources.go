@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+)
+
+// WithResource makes a shared dependency such as a *sql.DB or client pool
+// available to every node under name, instead of nodes reaching into package
+// globals. Tests can swap the resource for a fake.
+//
+//	e := engine.New(registry, engine.WithResource("db", db))
+func WithResource(name string, resource any) Option {
+	return func(e *Engine) {
+		if e.resources == nil {
+			e.resources = make(map[string]any)
+		}
+		e.resources[name] = resource
+	}
+}
+
+// withResources returns a context carrying the engine's resources
+func withResources(ctx context.Context, resources map[string]any) context.Context {
+	if len(resources) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, resourcesKey, resources)
+}
+
+// Resource returns the resource registered under name with WithResource,
+// typed as T. Nodes call it with the ctx passed to their Run:
+//
+//	db, err := engine.Resource[*sql.DB](ctx, "db")
+func Resource[T any](ctx context.Context, name string) (T, error) {
+	var zero T
+
+	resources, _ := ctx.Value(resourcesKey).(map[string]any)
+	resource, ok := resources[name]
+	if !ok {
+		return zero, requireError(ctx, "resource %s not provided", name)
+	}
+
+	typed, ok := resource.(T)
+	if !ok {
+		return zero, requireError(ctx, "invalid type for resource %s: expected %s, got %T",
+			name, reflect.TypeFor[T](), resource)
+	}
+	return typed, nil
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// RetryPolicy retries a failing node's Run, see Node.Retry. The zero value
+// doesn't retry.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// Backoff is the wait before the second attempt; it doubles after every
+	// further failure
+	Backoff time.Duration
+	// MaxBackoff caps the wait between attempts; zero means no cap other than
+	// the longest Duration, at which the doubling saturates
+	MaxBackoff time.Duration
+	// Jitter randomizes each wait by up to ±Jitter of itself, e.g. 0.2 for
+	// ±20%, so nodes failing together don't retry in lockstep
+	Jitter float64
+	// Rand draws the jitter; nil uses the global source. A seeded source
+	// makes the waits reproducible, e.g. in tests. The engine serializes its
+	// draws, so one policy can be shared by nodes and engines retrying at
+	// the same time, though their interleaving then decides who gets which
+	// draw.
+	Rand *rand.Rand
+}
+
+// randMu guards every RetryPolicy.Rand, which isn't safe for concurrent use
+// on its own; draws only happen between retry attempts, so it's uncontended
+var randMu sync.Mutex
+
+// maxDelay is the longest wait delay returns
+const maxDelay = time.Duration(math.MaxInt64)
+
+// delay returns how long to wait after the given failed attempt, counting from 1
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for range attempt - 1 {
+		if d > maxDelay/2 {
+			d = maxDelay
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		random := rand.Float64()
+		if p.Rand != nil {
+			randMu.Lock()
+			random = p.Rand.Float64()
+			randMu.Unlock()
+		}
+		// Computed in floating point, which can't overflow, then clamped
+		jittered := float64(d) + (random*2-1)*p.Jitter*float64(d)
+		if jittered >= float64(maxDelay) {
+			return maxDelay
+		}
+		d = time.Duration(jittered)
+	}
+	return max(d, 0)
+}
+
+// do calls run until it succeeds or the attempts are used up, waiting between
+// attempts. ErrSkip, ErrHalt and context errors are final, as is the run's
+// context being done.
+func (p RetryPolicy) do(ctx context.Context, nodeID string, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		wait := p.delay(attempt)
+		Printf(ctx, "  ↻ %s attempt %d/%d failed: %v, retrying in %s\n", nodeID, attempt, p.MaxAttempts, err, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+func retryable(err error) bool {
+	return !errors.Is(err, ErrSkip) && !errors.Is(err, ErrHalt) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,22 @@
+package engine
+
+import "context"
+
+// Runnable is an alternative to the Node struct literal for nodes that carry
+// their own config or state: implement the method set on a struct and register
+// it with catalog.RegisterRunnable.
+type Runnable interface {
+	ID() string
+	DependsOn() []string
+	Run(ctx context.Context, deps map[string]Result) (Result, error)
+}
+
+// NodeFrom adapts a Runnable into a Node so the engine can schedule it like any
+// other node.
+func NodeFrom(r Runnable) Node {
+	return Node{
+		ID:        r.ID(),
+		DependsOn: r.DependsOn(),
+		Run:       r.Run,
+	}
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// GraphSpec is the JSON description of a graph's topology. It is produced by
+// GraphJSON and consumed by FromSpec, so the two round-trip.
+type GraphSpec struct {
+	Nodes []NodeSpec `json:"nodes"`
+	// Edges lists every dependency as producer → consumer for tools that draw
+	// the graph. It is derived from Nodes and ignored by FromSpec.
+	Edges []EdgeSpec `json:"edges,omitempty"`
+}
+
+// NodeSpec describes one node, the IDs it depends on and the IDs it runs after
+// (see Node.After). Version is the node's version and Requires maps each
+// dependency that requires a version to its constraint (see Node.Version).
+type NodeSpec struct {
+	ID        string            `json:"id"`
+	Version   string            `json:"version,omitempty"`
+	DependsOn []string          `json:"depends_on"`
+	Requires  map[string]string `json:"requires,omitempty"`
+	After     []string          `json:"after,omitempty"`
+}
+
+// EdgeSpec is an edge pointing from the producer to the consumer. Kind is
+// empty for a dependency and EdgeAfter for an ordering-only After edge.
+type EdgeSpec struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind,omitempty"`
+}
+
+// EdgeAfter is the Kind of an edge from a Node.After entry, which orders the
+// two nodes without passing a result
+const EdgeAfter = "after"
+
+// Spec returns the engine's topology with nodes and edges sorted by ID
+func (e *Engine) Spec() GraphSpec {
+	spec := GraphSpec{Nodes: []NodeSpec{}}
+	for _, id := range sortedIDs(e.nodes) {
+		deps := sortedDeps(e.nodes[id])
+		if deps == nil {
+			deps = []string{}
+		}
+		var after []string
+		if len(e.nodes[id].After) > 0 {
+			after = slices.Sorted(slices.Values(e.nodes[id].After))
+		}
+		spec.Nodes = append(spec.Nodes, NodeSpec{
+			ID:        id,
+			Version:   e.nodes[id].Version,
+			DependsOn: deps,
+			Requires:  maps.Clone(e.nodes[id].versionReqs),
+			After:     after,
+		})
+	}
+	spec.Edges = e.edges()
+	return spec
+}
+
+// edges returns every dependency as an edge from the node producing it to the
+// consumer, so a sub-ID or alias points at the node that emits it, followed by
+// the consumer's After edges to nodes in the engine, sorted by consumer and
+// producer
+func (e *Engine) edges() []EdgeSpec {
+	var edges []EdgeSpec
+	for _, id := range sortedIDs(e.nodes) {
+		var from []string
+		for _, dep := range e.nodes[id].DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok {
+				dep = producer
+			}
+			from = append(from, dep)
+		}
+		slices.Sort(from)
+		for _, producer := range slices.Compact(from) {
+			edges = append(edges, EdgeSpec{From: producer, To: id})
+		}
+
+		var after []string
+		for _, ref := range e.nodes[id].After {
+			if producer, ok := producerOf(e.nodes, ref); ok {
+				after = append(after, producer)
+			}
+		}
+		slices.Sort(after)
+		for _, producer := range slices.Compact(after) {
+			edges = append(edges, EdgeSpec{From: producer, To: id, Kind: EdgeAfter})
+		}
+	}
+	return edges
+}
+
+// GraphJSON returns the engine's topology as indented JSON (see GraphSpec)
+func (e *Engine) GraphJSON() ([]byte, error) {
+	return json.MarshalIndent(e.Spec(), "", "  ")
+}
+
+// WriteDOT writes the dependency graph in Graphviz DOT format. Edges point from
+// a dependency to the node that consumes it, following the flow of results;
+// After edges, which only order the nodes, are dashed.
+func (e *Engine) WriteDOT(w io.Writer) error {
+	ids := sortedIDs(e.nodes)
+
+	var b strings.Builder
+	b.WriteString("digraph graph_builder {\n")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "  %q;\n", id)
+	}
+	for _, edge := range e.edges() {
+		if edge.Kind == EdgeAfter {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", edge.From, edge.To)
+			continue
+		}
+		fmt.Fprintf(&b, "  %q -> %q;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// LayoutNode positions a node for drawing: Level is its column (or row) and
+// Index its place within the level
+type LayoutNode struct {
+	ID    string `json:"id"`
+	Level int    `json:"level"`
+	Index int    `json:"index"`
+}
+
+// Layout returns a position for every node so a frontend can draw the graph
+// without its own topological sort. Spec's edges connect them: they point at
+// the node producing a sub-ID or alias, so every edge ends at a laid-out node. Levels are
+// sorted by ID, so the same graph always gets the same layout and re-renders
+// don't jitter. It errors if the graph can't be leveled.
+func (e *Engine) Layout() ([]LayoutNode, error) {
+	levels, err := e.topoSortLevels()
+	if err != nil {
+		return nil, err
+	}
+	var layout []LayoutNode
+	for level, ids := range levels {
+		for index, id := range ids {
+			layout = append(layout, LayoutNode{ID: id, Level: level, Index: index})
+		}
+	}
+	return layout, nil
+}
+
+// FromSpec builds an engine from a JSON GraphSpec. Every node gets a placeholder
+// Run that returns an empty Result, which makes it easy to exercise the
+// scheduler against arbitrary shapes or to inspect a topology defined outside
+// Go. Nodes whose sub-IDs are depended on get a placeholder RunMulti emitting
+// them instead. The graph is validated, so unknown dependencies, cycles and
+// unsatisfied version constraints are errors.
+func FromSpec(r io.Reader) (*Engine, error) {
+	var spec GraphSpec
+	if err := json.NewDecoder(r).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("decoding graph spec: %w", err)
+	}
+
+	nodes := make(map[string]Node, len(spec.Nodes))
+	for _, n := range spec.Nodes {
+		if n.ID == "" {
+			return nil, fmt.Errorf("graph spec contains a node without an id")
+		}
+		if _, exists := nodes[n.ID]; exists {
+			return nil, fmt.Errorf("graph spec declares node %s more than once", n.ID)
+		}
+		deps := slices.Clone(n.DependsOn)
+		for i, dep := range deps {
+			if constraint, ok := n.Requires[dep]; ok {
+				deps[i] = dep + VersionSeparator + constraint
+			}
+		}
+		nodes[n.ID] = Node{
+			ID:        n.ID,
+			Version:   n.Version,
+			DependsOn: deps,
+			After:     n.After,
+			Run:       placeholderRun(n.ID),
+		}
+	}
+
+	// A dependency on a sub-ID, e.g. "record/0", makes its producer a fan-out
+	// node emitting every sub-ID its dependents reference
+	subIDs := make(map[string][]string)
+	for _, n := range spec.Nodes {
+		for _, dep := range n.DependsOn {
+			producer, _, found := strings.Cut(dep, SubIDSeparator)
+			if _, declared := nodes[dep]; declared || !found {
+				continue
+			}
+			if _, ok := nodes[producer]; ok && !slices.Contains(subIDs[producer], dep) {
+				subIDs[producer] = append(subIDs[producer], dep)
+			}
+		}
+	}
+	for id, emitted := range subIDs {
+		node := nodes[id]
+		node.Run = nil
+		node.RunMulti = placeholderRunMulti(id, emitted)
+		nodes[id] = node
+	}
+
+	e := New(nodes)
+	if _, err := e.topoSortLevels(); err != nil {
+		return nil, fmt.Errorf("invalid graph spec: %w", err)
+	}
+	if err := checkVersions(e.nodes); err != nil {
+		return nil, fmt.Errorf("invalid graph spec: %w", err)
+	}
+	return e, nil
+}
+
+// placeholderRun is a no-op run function for nodes loaded from a spec
+func placeholderRun(id string) RunFunc {
+	return func(ctx context.Context, deps map[string]Result) (Result, error) {
+		return Result{ID: id}, nil
+	}
+}
+
+// placeholderRunMulti is placeholderRun for fan-out nodes loaded from a spec,
+// emitting an empty Result for the node and each of subIDs
+func placeholderRunMulti(id string, subIDs []string) MultiRunFunc {
+	return func(ctx context.Context, deps map[string]Result) ([]Result, error) {
+		results := []Result{{ID: id}}
+		for _, subID := range subIDs {
+			results = append(results, Result{ID: subID})
+		}
+		return results, nil
+	}
+}
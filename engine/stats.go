@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"slices"
+	"sort"
+)
+
+// Stats summarizes the shape of a node graph without building or running it
+type Stats struct {
+	Nodes int `json:"nodes"`
+	// Roots have no dependencies
+	Roots int `json:"roots"`
+	// Leaves have no dependents
+	Leaves int `json:"leaves"`
+	// MaxDepth is the number of nodes on the longest dependency chain, which
+	// is also the number of execution levels
+	MaxDepth int `json:"max_depth"`
+	// MaxFanOut is the largest number of dependents of a single node
+	MaxFanOut int `json:"max_fan_out"`
+}
+
+// GraphStats computes structural statistics over a set of nodes. Dependencies on
+// nodes outside the set are ignored so it can be used on an unvalidated catalog.
+func GraphStats(nodes map[string]Node) Stats {
+	stats := Stats{Nodes: len(nodes)}
+
+	dependents := make(map[string]int)
+	for _, node := range nodes {
+		producers := make(map[string]bool)
+		for _, dep := range node.normalize().DependsOn {
+			if producer, ok := producerOf(nodes, dep); ok {
+				producers[producer] = true
+			}
+		}
+		if len(producers) == 0 {
+			stats.Roots++
+		}
+		for producer := range producers {
+			dependents[producer]++
+		}
+	}
+
+	for id := range nodes {
+		count := dependents[id]
+		if count == 0 {
+			stats.Leaves++
+		}
+		stats.MaxFanOut = max(stats.MaxFanOut, count)
+	}
+
+	// depth is memoized; visiting guards against cycles in an unvalidated graph
+	depth := make(map[string]int)
+	visiting := make(map[string]bool)
+	var depthOf func(id string) int
+	depthOf = func(id string) int {
+		if d, ok := depth[id]; ok {
+			return d
+		}
+		if visiting[id] {
+			return 0
+		}
+		visiting[id] = true
+		d := 0
+		for _, dep := range nodes[id].normalize().DependsOn {
+			if producer, ok := producerOf(nodes, dep); ok {
+				d = max(d, depthOf(producer))
+			}
+		}
+		visiting[id] = false
+		depth[id] = d + 1
+		return d + 1
+	}
+
+	for id := range nodes {
+		stats.MaxDepth = max(stats.MaxDepth, depthOf(id))
+	}
+
+	return stats
+}
+
+// Roots returns the sorted IDs of the nodes without dependencies. Like
+// GraphStats, dependencies on nodes outside the set are ignored.
+func Roots(nodes map[string]Node) []string {
+	var roots []string
+	for id, node := range nodes {
+		if !slices.ContainsFunc(node.normalize().DependsOn, func(dep string) bool {
+			_, ok := producerOf(nodes, dep)
+			return ok
+		}) {
+			roots = append(roots, id)
+		}
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// Leaves returns the sorted IDs of the nodes nothing depends on, i.e. the
+// terminal nodes worth building for
+func Leaves(nodes map[string]Node) []string {
+	hasDependents := make(map[string]bool)
+	for _, node := range nodes {
+		for _, dep := range node.normalize().DependsOn {
+			if producer, ok := producerOf(nodes, dep); ok {
+				hasDependents[producer] = true
+			}
+		}
+	}
+	var leaves []string
+	for id := range nodes {
+		if !hasDependents[id] {
+			leaves = append(leaves, id)
+		}
+	}
+	sort.Strings(leaves)
+	return leaves
+}
+
+// GraphMetrics are structural metrics of an engine's graph, cheap enough to
+// compute and track on every deploy
+type GraphMetrics struct {
+	Nodes int `json:"nodes"`
+	// Edges counts dependencies between nodes; several sub-IDs of one fan-out
+	// node referenced by the same dependent count as one edge
+	Edges int `json:"edges"`
+	// MaxDepth is the number of execution levels
+	MaxDepth int `json:"max_depth"`
+	// MaxWidth is the number of nodes in the largest level
+	MaxWidth int `json:"max_width"`
+	// AvgFanIn is the mean number of dependencies per node and AvgFanOut the
+	// mean number of dependents. Every edge has one end of each, so they are
+	// equal for a valid graph; both are reported for readability.
+	AvgFanIn  float64 `json:"avg_fan_in"`
+	AvgFanOut float64 `json:"avg_fan_out"`
+}
+
+// Metrics returns structural metrics over the engine's graph without running
+// it. MaxDepth and MaxWidth describe the levels Levels returns, so After edges
+// and seeded nodes count; if the graph is invalid (e.g. has a cycle) both are
+// reported as zero.
+func (e *Engine) Metrics() GraphMetrics {
+	m := GraphMetrics{Nodes: len(e.nodes)}
+
+	for _, node := range e.nodes {
+		producers := make(map[string]bool)
+		for _, dep := range node.normalize().DependsOn {
+			if producer, ok := producerOf(e.nodes, dep); ok {
+				producers[producer] = true
+			}
+		}
+		m.Edges += len(producers)
+	}
+
+	if levels, err := e.topoSortLevels(); err == nil {
+		m.MaxDepth = len(levels)
+		for _, level := range levels {
+			m.MaxWidth = max(m.MaxWidth, len(level))
+		}
+	}
+
+	if m.Nodes > 0 {
+		m.AvgFanIn = float64(m.Edges) / float64(m.Nodes)
+		m.AvgFanOut = m.AvgFanIn
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"context"
+	"sort"
+)
+
+// RunStream runs the graph like RunContext but also sends each result on the
+// returned channel as soon as its node completes, so a server can stream
+// partial progress instead of blocking until the whole graph is done. A
+// RunMulti node sends its own result first, then its sub-results by ID.
+//
+// The results channel is closed once the run and any Detached nodes it
+// started have finished; the run's error, or nil, is then sent on the error
+// channel. Nodes wait for the caller to receive their result, so read the
+// results until the channel closes before reading the error. Results sent
+// after ctx is done are dropped. The results are stored on the engine too.
+func (e *Engine) RunStream(ctx context.Context) (<-chan Result, <-chan error) {
+	results := make(chan Result)
+	errs := make(chan error, 1)
+
+	// The listener is scoped to this run, so it doesn't race with listeners
+	// registered on the engine or see the events of other runs
+	runCtx := withListener(ctx, func(ev event) {
+		if ev.Kind != eventCompleted {
+			return
+		}
+		for _, result := range streamOrder(ev.Node, ev.Results) {
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	go func() {
+		err := e.RunContext(runCtx)
+		e.detached.Wait()
+		close(results)
+		errs <- err
+		close(errs)
+	}()
+	return results, errs
+}
+
+// streamOrder returns a node's results with its own first, then by ID
+func streamOrder(nodeID string, results map[string]Result) []Result {
+	ordered := make([]Result, 0, len(results))
+	for _, result := range results {
+		ordered = append(ordered, result)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if (ordered[i].ID == nodeID) != (ordered[j].ID == nodeID) {
+			return ordered[i].ID == nodeID
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	return ordered
+}
@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubGraphNode packages a whole engine as one node of a parent graph. When the
+// node runs, a Clone of sub is seeded with the node's dependency results, run,
+// and the result of its terminal node becomes this node's Result. sub's nodes
+// read the parent's dependencies by their IDs, which need not exist in sub
+// since seeds satisfy them. The parent treats the sub-graph as opaque: only
+// id and deps take part in its planning and validation. The terminal node is
+// the single target of a BuildFor engine or else sub's only leaf; SubGraphNode
+// panics if there isn't exactly one.
+func SubGraphNode(id string, deps []string, sub *Engine) Node {
+	terminal := ""
+	switch leaves := Leaves(sub.nodes); {
+	case len(sub.targets) == 1:
+		terminal = sub.targets[0]
+	case len(leaves) == 1:
+		terminal = leaves[0]
+	default:
+		panic(fmt.Sprintf("engine.SubGraphNode %s: sub-graph needs a single terminal node, has %v", id, leaves))
+	}
+
+	return Node{
+		ID:        id,
+		DependsOn: deps,
+		Run: func(ctx context.Context, deps map[string]Result) (Result, error) {
+			// A clone per run, since the parent may run concurrently
+			run := sub.Clone()
+			run.SetOutput(Output(ctx))
+			for _, result := range deps {
+				run.Seed(result)
+			}
+			if err := run.RunContext(ctx); err != nil {
+				return Result{}, fmt.Errorf("sub-graph: %w", err)
+			}
+
+			run.mu.RLock()
+			result, ok := run.resultFor(terminal)
+			run.mu.RUnlock()
+			if !ok {
+				return Result{}, fmt.Errorf("sub-graph: terminal node %s has no result", terminal)
+			}
+			return Result{ID: id, Data: result.Data, Meta: result.Meta}, nil
+		},
+	}
+}
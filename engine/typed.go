@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// TypedNode declares a node by its typed input and output, so the engine
+// does the type assertions a hand-written FromDeps would. In is a struct
+// whose exported fields name the dependency they are filled from in a `dep`
+// tag:
+//
+//	type in struct {
+//		N1 node1.Output `dep:"node1"`
+//	}
+//
+//	node, err := engine.TypedNode[in, Output]{
+//		ID:        ID,
+//		DependsOn: []string{node1.ID},
+//		Run:       func(ctx context.Context, in in) (Output, error) { ... },
+//	}.Node()
+//
+// DependsOn must list exactly the tagged dependencies, optionally with a
+// version constraint, so the edges stay visible where every other node
+// declares them. The tagged dependencies become typed Inputs, checked before
+// Run is called. Run's Out is boxed into Result.Data.
+type TypedNode[In, Out any] struct {
+	ID        string
+	DependsOn []string
+	Run       func(ctx context.Context, in In) (Out, error)
+}
+
+// Node returns the engine Node. It errors if In isn't a struct, a tagged
+// field is unexported or the tags don't match DependsOn, since the mistake is
+// in the node's declaration rather than in any run.
+func (n TypedNode[In, Out]) Node() (Node, error) {
+	inType := reflect.TypeFor[In]()
+	if inType.Kind() != reflect.Struct {
+		return Node{}, fmt.Errorf("engine.TypedNode %s: input must be a struct, got %s", n.ID, inType)
+	}
+
+	// fields maps each tagged field's index to the dependency it reads
+	fields := make(map[int]string)
+	node := Node{ID: n.ID, DependsOn: slices.Clone(n.DependsOn)}
+	var tagged []string
+	for i := range inType.NumField() {
+		field := inType.Field(i)
+		dep, ok := field.Tag.Lookup("dep")
+		if !ok {
+			continue
+		}
+		if !field.IsExported() {
+			return Node{}, fmt.Errorf("engine.TypedNode %s: field %s reads %s but is unexported", n.ID, field.Name, dep)
+		}
+		fields[i] = dep
+		tagged = append(tagged, dep)
+		node.Inputs = append(node.Inputs, InputSpec{ID: dep, TypeCheck: typeCheck(dep, field.Type)})
+	}
+
+	var declared []string
+	for _, dep := range n.DependsOn {
+		id, _ := SplitVersion(dep)
+		declared = append(declared, id)
+	}
+	slices.Sort(declared)
+	slices.Sort(tagged)
+	if !slices.Equal(slices.Compact(declared), slices.Compact(tagged)) {
+		return Node{}, fmt.Errorf("engine.TypedNode %s: DependsOn %v doesn't match the dep tags %v", n.ID, declared, tagged)
+	}
+
+	id, run := n.ID, n.Run
+	node.Run = func(ctx context.Context, deps map[string]Result) (Result, error) {
+		in := reflect.New(inType).Elem()
+		for i, dep := range fields {
+			field := in.Field(i)
+			data := reflect.ValueOf(deps[dep].Data)
+			if !data.IsValid() || !data.Type().AssignableTo(field.Type()) {
+				return Result{}, fmt.Errorf("invalid data type for %s: expected %s, got %T", dep, field.Type(), deps[dep].Data)
+			}
+			field.Set(data)
+		}
+		out, err := run(ctx, in.Interface().(In))
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{ID: id, Data: out}, nil
+	}
+	return node, nil
+}
+
+// typeCheck is the reflection counterpart of Input's TypeCheck for a field
+// of type t
+func typeCheck(id string, t reflect.Type) func(Result) error {
+	return func(r Result) error {
+		if err := unavailable(id, r); err != nil {
+			return err
+		}
+		if r.Data == nil || !reflect.TypeOf(r.Data).AssignableTo(t) {
+			return fmt.Errorf("invalid data type for %s: expected %s, got %T", id, t, r.Data)
+		}
+		return nil
+	}
+}
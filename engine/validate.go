@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Problem is one structural issue Validate found in a graph
+type Problem struct {
+	// Node is the ID of the offending node
+	Node string
+	// Message describes the problem, naming the node
+	Message string
+}
+
+func problemf(node, format string, args ...any) Problem {
+	return Problem{Node: node, Message: fmt.Sprintf(format, args...)}
+}
+
+// ValidationError lists every structural problem of a graph, so a freshly
+// wired graph can be fixed in one pass instead of one error at a time
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error formats each problem on its own line
+func (v *ValidationError) Error() string {
+	if len(v.Problems) == 1 {
+		return "invalid graph: " + v.Problems[0].Message
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid graph: %d problems:", len(v.Problems))
+	for _, p := range v.Problems {
+		b.WriteString("\n  " + p.Message)
+	}
+	return b.String()
+}
+
+// Validate checks the graph can be planned and returns a *ValidationError
+// listing every problem found rather than stopping at the first: IDs that
+// don't match their registration or collide with an alias, nodes depending on
+// themselves or on unknown nodes, conditions outside DependsOn, every cycle,
+// unsatisfied version constraints, dependents of Detached nodes and, when
+// DetectWriteConflicts is enabled, conflicting writes within a level.
+func (e *Engine) Validate() error {
+	var problems []Problem
+	problems = append(problems, e.idProblems()...)
+	problems = append(problems, e.dependencyProblems()...)
+	problems = append(problems, e.cycleProblems()...)
+	problems = append(problems, versionProblems(e.nodes)...)
+	problems = append(problems, detachedProblems(e.nodes)...)
+
+	// Write conflicts need levels, which only exist for an otherwise sound graph
+	if len(problems) == 0 {
+		levels, err := e.topoSortLevels()
+		if err != nil {
+			return err
+		}
+		if err := e.checkWriteConflicts(levels); err != nil {
+			problems = append(problems, Problem{Node: levels[0][0], Message: err.Error()})
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Node < problems[j].Node })
+	return &ValidationError{Problems: problems}
+}
+
+// idProblems reports nodes registered under another ID and aliases that
+// collide with node IDs or other aliases
+func (e *Engine) idProblems() []Problem {
+	var problems []Problem
+	owners := make(map[string]string)
+	for _, id := range sortedIDs(e.nodes) {
+		node := e.nodes[id]
+		if node.ID != id {
+			problems = append(problems, problemf(id, "node %s is registered under ID %s", node.ID, id))
+		}
+		for _, alias := range node.Aliases {
+			if _, taken := e.nodes[alias]; taken {
+				problems = append(problems, problemf(id, "node %s has alias %s, which is also a node ID", id, alias))
+			} else if owner, taken := owners[alias]; taken {
+				problems = append(problems, problemf(id, "node %s has alias %s, which is also an alias of %s", id, alias, owner))
+			} else {
+				owners[alias] = id
+			}
+		}
+	}
+	return problems
+}
+
+// dependencyProblems reports self-references, unknown dependencies and
+// conditions on dependencies missing from DependsOn
+func (e *Engine) dependencyProblems() []Problem {
+	var problems []Problem
+	for _, id := range sortedIDs(e.nodes) {
+		node := e.nodes[id]
+		for _, dep := range node.DependsOn {
+			if _, seeded := e.seeds[dep]; seeded {
+				continue
+			}
+			producer, ok := producerOf(e.nodes, dep)
+			switch {
+			case !ok:
+				problems = append(problems, problemf(id, "node %s depends on unknown node %s", id, dep))
+			case producer == id:
+				problems = append(problems, problemf(id, "node %s depends on itself", id))
+			}
+		}
+		for _, dep := range slices.Sorted(maps.Keys(node.ConditionalDeps)) {
+			if !slices.Contains(node.DependsOn, dep) {
+				problems = append(problems, problemf(id, "node %s has a condition on %s which is not in DependsOn", id, dep))
+			}
+		}
+	}
+	return problems
+}
+
+// cycleProblems reports every cycle of two or more nodes, found as the
+// strongly connected components of the dependency graph (Tarjan's algorithm).
+// Self-references are reported by dependencyProblems.
+func (e *Engine) cycleProblems() []Problem {
+	index := make(map[string]int)
+	lowlink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+
+	var connect func(id string)
+	connect = func(id string) {
+		index[id] = len(index)
+		lowlink[id] = index[id]
+		stack = append(stack, id)
+		onStack[id] = true
+
+		edges := e.producersOf(e.nodes[id])
+		maps.Copy(edges, e.afterOf(e.nodes[id]))
+		for _, producer := range slices.Sorted(maps.Keys(edges)) {
+			if _, visited := index[producer]; !visited {
+				connect(producer)
+				lowlink[id] = min(lowlink[id], lowlink[producer])
+			} else if onStack[producer] {
+				lowlink[id] = min(lowlink[id], index[producer])
+			}
+		}
+
+		if lowlink[id] != index[id] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == id {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+
+	for _, id := range sortedIDs(e.nodes) {
+		if _, visited := index[id]; !visited {
+			connect(id)
+		}
+	}
+
+	problems := make([]Problem, len(cycles))
+	for i, cycle := range cycles {
+		problems[i] = problemf(cycle[0], "nodes %s form a dependency cycle", strings.Join(cycle, ", "))
+	}
+	return problems
+}
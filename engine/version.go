@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VersionSeparator separates a dependency ID from a version constraint in
+// DependsOn, e.g. "node1@>=2"
+const VersionSeparator = "@"
+
+// SplitVersion splits a DependsOn entry into the dependency ID and its version
+// constraint, which is empty if the entry doesn't require a version
+func SplitVersion(dep string) (id, constraint string) {
+	id, constraint, _ = strings.Cut(dep, VersionSeparator)
+	return id, constraint
+}
+
+// withVersionDeps strips version constraints from DependsOn into versionReqs
+func (n Node) withVersionDeps() Node {
+	if !slices.ContainsFunc(n.DependsOn, func(dep string) bool {
+		return strings.Contains(dep, VersionSeparator)
+	}) {
+		return n
+	}
+
+	deps := make([]string, len(n.DependsOn))
+	reqs := maps.Clone(n.versionReqs)
+	if reqs == nil {
+		reqs = make(map[string]string)
+	}
+	for i, dep := range n.DependsOn {
+		id, constraint := SplitVersion(dep)
+		deps[i] = id
+		if constraint != "" {
+			reqs[id] = constraint
+		}
+	}
+	n.DependsOn = deps
+	n.versionReqs = reqs
+	return n
+}
+
+// checkVersions verifies every version constraint in DependsOn is satisfied by
+// the producing node
+func checkVersions(nodes map[string]Node) error {
+	if problems := versionProblems(nodes); len(problems) > 0 {
+		return errors.New(problems[0].Message)
+	}
+	return nil
+}
+
+// versionProblems reports every unsatisfied version constraint
+func versionProblems(nodes map[string]Node) []Problem {
+	var problems []Problem
+	for _, id := range sortedIDs(nodes) {
+		node := nodes[id]
+		for _, dep := range slices.Sorted(maps.Keys(node.versionReqs)) {
+			constraint := node.versionReqs[dep]
+			producer, ok := producerOf(nodes, dep)
+			if !ok {
+				continue // reported as an unknown dependency
+			}
+			version := nodes[producer].Version
+			if version == "" {
+				problems = append(problems, problemf(id, "node %s requires %s@%s but %s is unversioned", id, dep, constraint, producer))
+				continue
+			}
+			ok, err := satisfies(version, constraint)
+			if err != nil {
+				problems = append(problems, problemf(id, "node %s: %v", id, err))
+				continue
+			}
+			if !ok {
+				problems = append(problems, problemf(id, "node %s requires %s@%s but %s is version %s", id, dep, constraint, producer, version))
+			}
+		}
+	}
+	return problems
+}
+
+// satisfies reports whether version meets a constraint such as ">=2", "<1.5"
+// or "3" (exact)
+func satisfies(version, constraint string) (bool, error) {
+	for _, op := range []string{">=", "<=", "==", ">", "<", "="} {
+		if want, found := strings.CutPrefix(constraint, op); found {
+			cmp := compareVersions(version, want)
+			switch op {
+			case ">=":
+				return cmp >= 0, nil
+			case "<=":
+				return cmp <= 0, nil
+			case ">":
+				return cmp > 0, nil
+			case "<":
+				return cmp < 0, nil
+			default:
+				return cmp == 0, nil
+			}
+		}
+	}
+	if constraint == "" {
+		return false, fmt.Errorf("empty version constraint")
+	}
+	return compareVersions(version, constraint) == 0, nil
+}
+
+// compareVersions compares dotted versions such as "1.10" and "1.9" part by
+// part, numerically where both parts are numbers. A leading "v" is ignored and
+// missing parts count as zero.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := range max(len(as), len(bs)) {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		if xerr == nil && yerr == nil {
+			if c := xn - yn; c != 0 {
+				return max(-1, min(1, c))
+			}
+			continue
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
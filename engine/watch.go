@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Watch runs the graph, then blocks re-running parts of it for a live-reload
+// development loop: whenever a node ID arrives on trigger, e.g. from a file
+// watcher noticing the node's inputs changed, that node and its transitive
+// dependents are invalidated and only they run again, against the results
+// the rest of the graph already holds. IDs arriving while a re-run is in
+// progress are batched into the next one. A failed or unknown re-run is
+// logged to the engine's output and watching continues. It returns the
+// initial run's error, or nil once ctx is done or trigger is closed.
+func (e *Engine) Watch(ctx context.Context, trigger <-chan string) error {
+	if err := e.RunContext(ctx); err != nil {
+		return err
+	}
+
+	for {
+		var ids []string
+		select {
+		case <-ctx.Done():
+			return nil
+		case id, ok := <-trigger:
+			if !ok {
+				return nil
+			}
+			ids = append(ids, id)
+		}
+	drain:
+		for {
+			select {
+			case id, ok := <-trigger:
+				if !ok {
+					break drain
+				}
+				ids = append(ids, id)
+			default:
+				break drain
+			}
+		}
+
+		affected := make(map[string]bool)
+		for _, id := range ids {
+			producer, ok := producerOf(e.nodes, id)
+			if !ok {
+				e.logf("\n⚠ watch: unknown node %s\n", id)
+				continue
+			}
+			for _, dependent := range e.dependentsClosure(producer) {
+				affected[dependent] = true
+			}
+		}
+		if len(affected) == 0 {
+			continue
+		}
+
+		e.invalidate(affected)
+		e.rerun = affected
+		err := e.RunContext(ctx)
+		e.rerun = nil
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			e.logf("\n⚠ watch: re-run failed: %v\n", err)
+		}
+	}
+}
+
+// dependentsClosure returns id and every node that transitively depends on
+// it, sorted
+func (e *Engine) dependentsClosure(id string) []string {
+	dependents := make(map[string][]string)
+	for _, node := range e.nodes {
+		for producer := range e.producersOf(node) {
+			dependents[producer] = append(dependents[producer], node.ID)
+		}
+	}
+
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dependents[current] {
+			if !seen[dependent] {
+				seen[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	closure := make([]string, 0, len(seen))
+	for node := range seen {
+		closure = append(closure, node)
+	}
+	sort.Strings(closure)
+	return closure
+}
+
+// invalidate forgets everything the last runs recorded about the given nodes,
+// including the sub-results of fan-out nodes, so they run again
+func (e *Engine) invalidate(ids map[string]bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for resultID := range e.results {
+		owner, _, _ := strings.Cut(resultID, SubIDSeparator)
+		if ids[resultID] || ids[owner] && e.nodes[owner].RunMulti != nil {
+			delete(e.results, resultID)
+		}
+	}
+	for id := range ids {
+		delete(e.durations, id)
+		delete(e.skipped, id)
+		delete(e.skippedByNode, id)
+		delete(e.timedOut, id)
+		delete(e.finished, id)
+		delete(e.failed, id)
+	}
+}
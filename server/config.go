@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
+
+// config holds the server's operational knobs. Each is read from an
+// environment variable and can be overridden by a flag; the defaults match
+// the server's original hard-coded behavior.
+type config struct {
+	// Addr is the listen address ($GRAPH_ADDR, -addr)
+	Addr string
+	// MaxParallelism caps the nodes run at once within a level; zero is
+	// unlimited ($GRAPH_MAX_PARALLELISM, -max-parallelism)
+	MaxParallelism int
+	// RunTimeout bounds each request's graph run; zero is no timeout
+	// ($GRAPH_RUN_TIMEOUT, -run-timeout)
+	RunTimeout time.Duration
+	// AllowedNodes restricts the targets clients may request from
+	// /graph/custom and /graph/run; empty allows every node
+	// ($GRAPH_ALLOWED_NODES, -allowed-nodes, comma-separated)
+	AllowedNodes []string
+	// Definition is the path of a JSON graph definition re-wiring the
+	// catalog's edges (see engine.Definition); empty keeps the registered
+	// edges ($GRAPH_DEFINITION, -definition)
+	Definition string
+}
+
+func defaultConfig() config {
+	return config{Addr: ":8080"}
+}
+
+// loadConfig builds the config from the environment and command-line args
+func loadConfig(args []string, getenv func(string) string) (config, error) {
+	cfg := defaultConfig()
+
+	if v := getenv("GRAPH_ADDR"); v != "" {
+		cfg.Addr = v
+	}
+	if v := getenv("GRAPH_MAX_PARALLELISM"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return config{}, fmt.Errorf("GRAPH_MAX_PARALLELISM: %w", err)
+		}
+		cfg.MaxParallelism = n
+	}
+	if v := getenv("GRAPH_RUN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return config{}, fmt.Errorf("GRAPH_RUN_TIMEOUT: %w", err)
+		}
+		cfg.RunTimeout = d
+	}
+	allowed := getenv("GRAPH_ALLOWED_NODES")
+	cfg.Definition = getenv("GRAPH_DEFINITION")
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "listen address")
+	fs.IntVar(&cfg.MaxParallelism, "max-parallelism", cfg.MaxParallelism, "max nodes run at once per level (0 = unlimited)")
+	fs.DurationVar(&cfg.RunTimeout, "run-timeout", cfg.RunTimeout, "timeout of each request's run (0 = none)")
+	fs.StringVar(&allowed, "allowed-nodes", allowed, "comma-separated targets clients may request (empty = all)")
+	fs.StringVar(&cfg.Definition, "definition", cfg.Definition, "JSON graph definition re-wiring the catalog's edges")
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	if cfg.MaxParallelism < 0 {
+		return config{}, fmt.Errorf("max parallelism must not be negative")
+	}
+	if cfg.RunTimeout < 0 {
+		return config{}, fmt.Errorf("run timeout must not be negative")
+	}
+	cfg.AllowedNodes = splitAndTrim(allowed)
+	return cfg, nil
+}
+
+// checkAllowed rejects targets outside the allow-list
+func (c config) checkAllowed(targets []string) error {
+	if len(c.AllowedNodes) == 0 {
+		return nil
+	}
+	var denied []string
+	for _, id := range targets {
+		if !slices.Contains(c.AllowedNodes, id) {
+			denied = append(denied, id)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("nodes not allowed: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// baseURL is the URL the demo client uses to reach the server
+func (c config) baseURL() string {
+	if strings.HasPrefix(c.Addr, ":") {
+		return "http://localhost" + c.Addr
+	}
+	return "http://" + c.Addr
+}
+
+// engineOptions applies the config to every engine the builder creates
+func (c config) engineOptions() []engine.Option {
+	return []engine.Option{engine.WithMaxConcurrency(c.MaxParallelism)}
+}
+
+// loadDefinition re-wires the builder's catalog with the definition file at
+// path, failing on any mismatch with the catalog before the server starts
+func loadDefinition(builder *engine.Builder, path string) (*engine.Builder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rewired, err := builder.LoadDefinition(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rewired, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	env := map[string]string{
+		"GRAPH_ADDR":            ":9090",
+		"GRAPH_MAX_PARALLELISM": "4",
+		"GRAPH_ALLOWED_NODES":   "node3, node4",
+		"GRAPH_DEFINITION":      "graph.json",
+	}
+	cfg, err := loadConfig([]string{"-max-parallelism", "2", "-run-timeout", "5s"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Addr:           ":9090",
+		MaxParallelism: 2, // the flag wins over the environment
+		RunTimeout:     5 * time.Second,
+		AllowedNodes:   []string{"node3", "node4"},
+		Definition:     "graph.json",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("loadConfig() = %+v, want %+v", cfg, want)
+	}
+
+	if err := cfg.checkAllowed([]string{"node3", "node2a"}); err == nil {
+		t.Error("checkAllowed(node2a) = nil, want an error")
+	}
+
+	if cfg, err := loadConfig(nil, func(string) string { return "" }); err != nil || !reflect.DeepEqual(cfg, defaultConfig()) {
+		t.Errorf("loadConfig() without settings = %+v, %v, want the defaults", cfg, err)
+	}
+	if _, err := loadConfig(nil, func(k string) string { return map[string]string{"GRAPH_RUN_TIMEOUT": "soon"}[k] }); err == nil {
+		t.Error("loadConfig() with a bad timeout succeeded, want an error")
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/grindlemire/graph-builder/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/catalog"
 )
 
@@ -22,8 +24,20 @@ func TestGraphIntegrity(t *testing.T) {
 	t.Run("dependencies_exist", func(t *testing.T) {
 		for id, node := range nodes {
 			for _, dep := range node.DependsOn {
+				// "node1@>=2" depends on node1 and requires a version of it
+				dep, constraint := engine.SplitVersion(dep)
+				producer := dep
 				if _, exists := nodes[dep]; !exists {
-					t.Errorf("node %q declares dependency on %q which doesn't exist in catalog", id, dep)
+					// sub-IDs like "record/0" are emitted by the fan-out node "record"
+					prefix, _, ok := strings.Cut(dep, engine.SubIDSeparator)
+					if !ok || nodes[prefix].RunMulti == nil {
+						t.Errorf("node %q declares dependency on %q which doesn't exist in catalog", id, dep)
+						continue
+					}
+					producer = prefix
+				}
+				if constraint != "" && nodes[producer].Version == "" {
+					t.Errorf("node %q requires %s@%s but %s is unversioned", id, dep, constraint, producer)
 				}
 			}
 		}
@@ -41,6 +55,7 @@ func TestGraphIntegrity(t *testing.T) {
 			cyclePath = append(cyclePath, id)
 
 			for _, dep := range nodes[id].DependsOn {
+				dep, _ := engine.SplitVersion(dep)
 				if !visited[dep] {
 					if hasCycle(dep) {
 						return true
@@ -97,7 +112,7 @@ func TestGraphIntegrity(t *testing.T) {
 
 			for _, used := range analyzer.usedDeps {
 				if !analyzer.declaredDeps[used] {
-					t.Errorf("%s/run.go: calls %s.FromDeps() but %s.ID is not in DependsOn",
+					t.Errorf("%s/run.go: reads %s's output (FromDeps, Require or ResultAs) but %s.ID is not in DependsOn",
 						entry.Name(), used, used)
 				}
 			}
@@ -148,6 +163,22 @@ func (a *nodeAnalyzer) checkFromDeps(n ast.Node) {
 	if !ok {
 		return
 	}
+
+	// engine.Require[T](ctx, deps, pkg.ID) and engine.ResultAs[T](deps, pkg.ID)
+	// name the dependency in their last argument
+	if idx, ok := call.Fun.(*ast.IndexExpr); ok {
+		sel, ok := idx.X.(*ast.SelectorExpr)
+		reads := ok && (sel.Sel.Name == "Require" && len(call.Args) == 3 || sel.Sel.Name == "ResultAs" && len(call.Args) == 2)
+		if reads {
+			if id, ok := call.Args[len(call.Args)-1].(*ast.SelectorExpr); ok && id.Sel.Name == "ID" {
+				if pkg, ok := id.X.(*ast.Ident); ok {
+					a.usedDeps = append(a.usedDeps, pkg.Name)
+				}
+			}
+		}
+		return
+	}
+
 	sel, ok := call.Fun.(*ast.SelectorExpr)
 	if !ok || sel.Sel.Name != "FromDeps" {
 		return
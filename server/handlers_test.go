@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/engine"
+	"github.com/grindlemire/graph-builder/server/pkg/catalog"
+	"github.com/grindlemire/graph-builder/server/pkg/client"
+)
+
+// BenchmarkHandlersParallel hits all three endpoints concurrently through one
+// shared Builder. Run it with -race to check the concurrency contract:
+//
+//	go test -race -run '^$' -bench HandlersParallel
+func BenchmarkHandlersParallel(b *testing.B) {
+	logOutput = io.Discard
+	srv := httptest.NewServer(newMux(engine.NewBuilder(catalog.All()), defaultConfig()))
+	defer srv.Close()
+
+	paths := []string{"/graph/small", "/graph/full", "/graph/custom?nodes=node2a,node4"}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			resp, err := http.Get(srv.URL + paths[i%len(paths)])
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				b.Errorf("%s: status %s", paths[i%len(paths)], resp.Status)
+			}
+			i++
+		}
+	})
+}
+
+func TestRunGraph(t *testing.T) {
+	logOutput = io.Discard
+	srv := httptest.NewServer(newMux(engine.NewBuilder(catalog.All()), defaultConfig()))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/graph/run", "application/json",
+		strings.NewReader(`{"nodes": ["node4"], "max_parallelism": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", resp.Status)
+	}
+	if resp.Header.Get(runIDHeader) == "" {
+		t.Errorf("response has no %s header", runIDHeader)
+	}
+
+	var body runResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body.Results["node4"]; !ok {
+		t.Errorf("results missing node4: %v", body.Results)
+	}
+	if len(body.Report.Levels) != 2 {
+		t.Errorf("report levels = %v, want node1 then node4", body.Report.Levels)
+	}
+	if nodes := body.Report.Execution.Nodes; len(nodes) != 2 || nodes[1].ID != "node4" || nodes[1].Status != engine.StatusCompleted {
+		t.Errorf("execution report nodes = %+v, want node4 completed", nodes)
+	}
+
+	for _, bad := range []string{`{"nodes": [`, `{}`, `{"nodes": ["node4"], "bogus": 1}`, `{"nodes": ["nope"]}`} {
+		resp, err := http.Post(srv.URL+"/graph/run", "application/json", strings.NewReader(bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status %s, want 400", bad, resp.Status)
+		}
+	}
+}
+
+func TestPartialResults(t *testing.T) {
+	logOutput = io.Discard
+	builder := engine.NewBuilder(map[string]engine.Node{
+		"up": {ID: "up", Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{ID: "up", Data: "salvaged"}, nil
+		}},
+		"down": {ID: "down", DependsOn: []string{"up"}, Run: func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{}, errors.New("boom")
+		}},
+	})
+	srv := httptest.NewServer(newMux(builder, defaultConfig()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/graph/custom?nodes=down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("without partial: status %s, want 500", resp.Status)
+	}
+
+	resp, err = http.Get(srv.URL + "/graph/custom?nodes=down&partial=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("with partial: status %s, want 207", resp.Status)
+	}
+	var body partialResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.Error, "boom") {
+		t.Errorf("error = %q, want the node failure", body.Error)
+	}
+	if body.Results["up"].Data != "salvaged" {
+		t.Errorf("results = %v, want up's result", body.Results)
+	}
+}
+
+func TestFullGraphDefinition(t *testing.T) {
+	logOutput = io.Discard
+	constant := func(id string) engine.RunFunc {
+		return func(ctx context.Context, _ map[string]engine.Result) (engine.Result, error) {
+			return engine.Result{ID: id, Data: id}, nil
+		}
+	}
+	builder := engine.NewBuilder(map[string]engine.Node{
+		"source": {ID: "source", Run: constant("source")},
+		"report": {ID: "report", DependsOn: []string{"source"}, Run: constant("report")},
+		"audit":  {ID: "audit", DependsOn: []string{"report"}, Run: constant("audit")},
+	})
+	// audit no longer consumes report, which becomes a leaf of its own
+	rewired, err := builder.LoadDefinition(strings.NewReader(`{"nodes": [{"id": "audit", "depends_on": ["source"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newMux(rewired, defaultConfig()))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/graph/full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", resp.Status)
+	}
+	var results map[string]engine.Result
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"source", "report", "audit"} {
+		if _, ok := results[id]; !ok {
+			t.Errorf("/graph/full results = %v, missing %s", results, id)
+		}
+	}
+}
+
+// BenchmarkBuildFull builds and plans the /graph/full subgraph the way a
+// handler does on every request, with and without the template cache.
+func BenchmarkBuildFull(b *testing.B) {
+	builds := map[string]func(*engine.Builder) (*engine.Engine, error){
+		"BuildFor":       func(bl *engine.Builder) (*engine.Engine, error) { return bl.BuildFor(bl.Leaves()...) },
+		"BuildForCached": func(bl *engine.Builder) (*engine.Engine, error) { return bl.BuildForCached(bl.Leaves()...) },
+	}
+	for name, build := range builds {
+		b.Run(name, func(b *testing.B) {
+			builder := engine.NewBuilder(catalog.All())
+			for b.Loop() {
+				e, err := build(builder)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := e.Levels(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphClient(t *testing.T) {
+	logOutput = io.Discard
+	srv := httptest.NewServer(newMux(engine.NewBuilder(catalog.All()), defaultConfig()))
+	defer srv.Close()
+	c := client.NewGraphClient(srv.URL)
+
+	resp, err := c.Full(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.RunID == "" || len(resp.Results) != 6 {
+		t.Errorf("Full() = run %q with %d results, want a run ID and 6 results", resp.RunID, len(resp.Results))
+	}
+
+	if _, err := c.Custom(context.Background(), "nope"); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Custom(unknown) error = %v, want a 400", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Small(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Small(canceled ctx) error = %v, want context.Canceled", err)
+	}
+}
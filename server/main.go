@@ -1,39 +1,54 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/grindlemire/graph-builder/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/catalog"
-	"github.com/grindlemire/graph-builder/server/pkg/engine"
-	"github.com/grindlemire/graph-builder/server/pkg/nodes/node3"
+	"github.com/grindlemire/graph-builder/server/pkg/client"
 	"github.com/grindlemire/graph-builder/server/pkg/nodes/node4"
 )
 
 func main() {
-	// Create a engineBuilder from the node catalog (populated via init())
-	engineBuilder := engine.NewBuilder(catalog.All())
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Set up routes
-	mux := http.NewServeMux()
-	mux.HandleFunc("/graph/small", handleSmallGraph(engineBuilder))
-	mux.HandleFunc("/graph/full", handleFullGraph(engineBuilder))
-	mux.HandleFunc("/graph/custom", handleCustomGraph(engineBuilder))
+	// Every engine reports its runs to the collector served on /metrics
+	runMetrics := newMetrics()
+
+	// Create a engineBuilder from the node catalog (populated via init())
+	engineBuilder := engine.NewBuilder(catalog.All(), append(cfg.engineOptions(), engine.WithMetrics(runMetrics))...)
+	// Nodes listed in $GRAPH_DISABLED_NODES are left out of every build
+	engineBuilder.SetEnabled(catalog.Enabled)
+	// A definition file re-wires the catalog's edges without recompiling
+	if cfg.Definition != "" {
+		if engineBuilder, err = loadDefinition(engineBuilder, cfg.Definition); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Create server with explicit handler
+	mux := newMux(engineBuilder, cfg)
+	mux.Handle("/metrics", runMetrics)
 	server := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Addr,
 		Handler: mux,
 	}
 
 	// Start server in goroutine
 	go func() {
-		fmt.Println("Server starting on :8080")
+		fmt.Printf("Server starting on %s\n", cfg.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Printf("Server error: %v", err)
 		}
@@ -43,7 +58,7 @@ func main() {
 	time.Sleep(100 * time.Millisecond)
 
 	// Run client tests
-	runClientTests()
+	runClientTests(cfg.baseURL())
 
 	// Shutdown server gracefully
 	fmt.Println("\n" + "═══════════════════════════════════════")
@@ -56,46 +71,92 @@ func main() {
 	fmt.Println("Server stopped.")
 }
 
-func runClientTests() {
-	client := &http.Client{Timeout: 10 * time.Second}
+// newMux sets up the routes. All handlers share one builder, which is safe
+// because BuildFor only reads the builder's catalog snapshot.
+func newMux(builder *engine.Builder, cfg config) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graph/small", withRunTimeout(cfg.RunTimeout, handleSmallGraph(builder)))
+	mux.HandleFunc("/graph/full", withRunTimeout(cfg.RunTimeout, handleFullGraph(builder)))
+	mux.HandleFunc("/graph/custom", withRunTimeout(cfg.RunTimeout, handleCustomGraph(builder, cfg)))
+	mux.HandleFunc("POST /graph/run", withRunTimeout(cfg.RunTimeout, handleRunGraph(builder, cfg)))
+	return mux
+}
+
+// withRunTimeout bounds the request's context, and so its graph run, by
+// timeout. Zero leaves the request unbounded.
+func withRunTimeout(timeout time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	if timeout <= 0 {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h(w, r.WithContext(ctx))
+	}
+}
+
+// logOutput receives each request's graph output. logMu makes every request's
+// block a single uninterrupted write.
+var (
+	logOutput io.Writer = os.Stdout
+	logMu     sync.Mutex
+)
+
+// captureOutput points the engine's output at a per-request buffer. The returned
+// flush writes the buffer to logOutput in one piece, so concurrent requests
+// don't interleave their graph printouts.
+func captureOutput(e *engine.Engine) (io.Writer, func()) {
+	var buf bytes.Buffer
+	e.SetOutput(&buf)
+	return &buf, func() {
+		logMu.Lock()
+		defer logMu.Unlock()
+		logOutput.Write(buf.Bytes())
+	}
+}
+
+// runIDHeader carries the engine's run ID so clients can find their run in
+// the server logs
+const runIDHeader = client.RunIDHeader
 
-	endpoints := []struct {
+func runClientTests(baseURL string) {
+	c := client.NewGraphClient(baseURL)
+
+	requests := []struct {
 		name string
 		url  string
+		call func(context.Context) (*client.Response, error)
 	}{
-		{"Small Graph (node4 only)", "http://localhost:8080/graph/small"},
-		{"Full Graph (node3 → all deps)", "http://localhost:8080/graph/full"},
-		{"Custom Graph (node2a,node4)", "http://localhost:8080/graph/custom?nodes=node2a,node4"},
+		{"Small Graph (node4 only)", "/graph/small", c.Small},
+		{"Full Graph (all leaves → all deps)", "/graph/full", c.Full},
+		{"Custom Graph (node2a,node4)", "/graph/custom?nodes=node2a,node4", func(ctx context.Context) (*client.Response, error) {
+			return c.Custom(ctx, "node2a", "node4")
+		}},
 	}
 
-	for _, ep := range endpoints {
+	for _, req := range requests {
 		fmt.Println("\n" + "═══════════════════════════════════════")
-		fmt.Printf("CLIENT: Requesting %s\n", ep.name)
-		fmt.Printf("        URL: %s\n", ep.url)
+		fmt.Printf("CLIENT: Requesting %s\n", req.name)
+		fmt.Printf("        URL: %s%s\n", baseURL, req.url)
 		fmt.Println("═══════════════════════════════════════")
 
-		resp, err := client.Get(ep.url)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		resp, err := req.call(ctx)
+		cancel()
 		if err != nil {
 			log.Printf("Request failed: %v", err)
 			continue
 		}
 
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		fmt.Printf("\nCLIENT: Response Status: %s\n", resp.Status)
-		fmt.Printf("CLIENT: Response Body:\n%s\n", prettyJSON(body))
+		fmt.Printf("\nCLIENT: Run ID: %s\n", resp.RunID)
+		fmt.Printf("CLIENT: Results:\n%s\n", prettyJSON(resp.Results))
 	}
 }
 
-func prettyJSON(data []byte) string {
-	var obj any
-	if err := json.Unmarshal(data, &obj); err != nil {
-		return string(data)
-	}
-	pretty, err := json.MarshalIndent(obj, "  ", "  ")
+func prettyJSON(v any) string {
+	pretty, err := json.MarshalIndent(v, "  ", "  ")
 	if err != nil {
-		return string(data)
+		return fmt.Sprint(v)
 	}
 	return "  " + string(pretty)
 }
@@ -104,17 +165,24 @@ func prettyJSON(data []byte) string {
 func handleSmallGraph(builder *engine.Builder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Only request node4 - node1 is auto-resolved as a dependency
-		e, err := builder.BuildFor(node4.ID)
+		e, err := builder.BuildForCached(node4.ID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		// Keep each node's log lines together when nodes run in parallel
+		e.BufferNodeOutput(true)
 
-		fmt.Println("\n=== /graph/small ===")
+		out, flush := captureOutput(e)
+		defer flush()
+
+		fmt.Fprintln(out, "\n=== /graph/small ===")
 		e.PrettyPrint()
 
-		if err := e.Run(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = e.RunContext(r.Context())
+		w.Header().Set(runIDHeader, e.LastRunID())
+		if err != nil {
+			respondRunError(w, r, e, err)
 			return
 		}
 
@@ -122,21 +190,29 @@ func handleSmallGraph(builder *engine.Builder) http.HandlerFunc {
 	}
 }
 
-// handleFullGraph runs the full graph ending at node3 (which pulls in node2a, node2b, node2c, node1)
+// handleFullGraph runs the full graph: every enabled terminal node of the
+// builder's graph and all of their dependencies, so new terminal nodes and a
+// definition file's re-wiring are picked up without editing the handler
 func handleFullGraph(builder *engine.Builder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Only request node3 - all dependencies are auto-resolved
-		e, err := builder.BuildFor(node3.ID)
+		// Only request the leaves - all dependencies are auto-resolved
+		e, err := builder.BuildForCached(builder.Leaves()...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		e.BufferNodeOutput(true)
+
+		out, flush := captureOutput(e)
+		defer flush()
 
-		fmt.Println("\n=== /graph/full ===")
+		fmt.Fprintln(out, "\n=== /graph/full ===")
 		e.PrettyPrint()
 
-		if err := e.Run(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = e.RunContext(r.Context())
+		w.Header().Set(runIDHeader, e.LastRunID())
+		if err != nil {
+			respondRunError(w, r, e, err)
 			return
 		}
 
@@ -145,7 +221,7 @@ func handleFullGraph(builder *engine.Builder) http.HandlerFunc {
 }
 
 // handleCustomGraph builds a graph from query params: ?nodes=node2a,node4
-func handleCustomGraph(builder *engine.Builder) http.HandlerFunc {
+func handleCustomGraph(builder *engine.Builder, cfg config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		nodesParam := r.URL.Query().Get("nodes")
 		if nodesParam == "" {
@@ -161,17 +237,30 @@ func handleCustomGraph(builder *engine.Builder) http.HandlerFunc {
 			}
 		}
 
+		if err := cfg.checkAllowed(targetNodes); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
 		e, err := builder.BuildFor(targetNodes...)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		e.BufferNodeOutput(true)
+		// Targets come from the client, so they don't label the metrics
+		e.SetGraphName("custom")
+
+		out, flush := captureOutput(e)
+		defer flush()
 
-		fmt.Printf("\n=== /graph/custom?nodes=%s ===\n", nodesParam)
+		fmt.Fprintf(out, "\n=== /graph/custom?nodes=%s ===\n", nodesParam)
 		e.PrettyPrint()
 
-		if err := e.Run(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err = e.RunContext(r.Context())
+		w.Header().Set(runIDHeader, e.LastRunID())
+		if err != nil {
+			respondRunError(w, r, e, err)
 			return
 		}
 
@@ -179,6 +268,98 @@ func handleCustomGraph(builder *engine.Builder) http.HandlerFunc {
 	}
 }
 
+// runRequest is the body of POST /graph/run
+type runRequest struct {
+	Nodes          []string `json:"nodes"`
+	MaxParallelism int      `json:"max_parallelism,omitempty"`
+}
+
+// runResponse is the reply of POST /graph/run
+type runResponse struct {
+	Report  runReport                `json:"report"`
+	Results map[string]engine.Result `json:"results"`
+}
+
+// runReport summarizes how a run went; Execution has the per-node details
+type runReport struct {
+	Levels    [][]string             `json:"levels"`
+	Durations map[string]string      `json:"durations"`
+	Skipped   map[string]string      `json:"skipped,omitempty"`
+	Execution engine.ExecutionReport `json:"execution"`
+}
+
+// handleRunGraph builds and runs a graph from a JSON body:
+// {"nodes": ["node3", "node4"], "max_parallelism": 2}
+func handleRunGraph(builder *engine.Builder, cfg config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req runRequest
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Nodes) == 0 {
+			http.Error(w, `request body must list at least one node (e.g. {"nodes": ["node3"]})`, http.StatusBadRequest)
+			return
+		}
+		if req.MaxParallelism < 0 {
+			http.Error(w, "max_parallelism must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		if err := cfg.checkAllowed(req.Nodes); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		e, err := builder.BuildFor(req.Nodes...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		e.BufferNodeOutput(true)
+		e.SetGraphName("run")
+		// A request may lower the server's parallelism cap but not lift it
+		if req.MaxParallelism > 0 && (cfg.MaxParallelism == 0 || req.MaxParallelism < cfg.MaxParallelism) {
+			e.SetMaxParallelism(req.MaxParallelism)
+		}
+
+		out, flush := captureOutput(e)
+		defer flush()
+
+		fmt.Fprintf(out, "\n=== POST /graph/run %v ===\n", req.Nodes)
+		e.PrettyPrint()
+
+		err = e.RunContext(r.Context())
+		w.Header().Set(runIDHeader, e.LastRunID())
+		if err != nil {
+			respondRunError(w, r, e, err)
+			return
+		}
+
+		levels, err := e.Levels()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		durations := make(map[string]string)
+		for id, d := range e.Durations() {
+			durations[id] = d.String()
+		}
+
+		respondJSON(w, runResponse{
+			Report: runReport{
+				Levels:    levels,
+				Durations: durations,
+				Skipped:   e.Skipped(),
+				Execution: e.Report(),
+			},
+			Results: e.Results(),
+		})
+	}
+}
+
 func splitAndTrim(s string) []string {
 	var result []string
 	start := 0
@@ -201,6 +382,26 @@ func splitAndTrim(s string) []string {
 	return result
 }
 
+// partialResponse is returned for a failed run when the client asked for
+// partial results with ?partial=true
+type partialResponse struct {
+	Error   string                   `json:"error"`
+	Results map[string]engine.Result `json:"results"`
+}
+
+// respondRunError reports a failed run. By default it's a plain 500; with
+// ?partial=true the client gets 207 Multi-Status with the error and the
+// results collected before the failure, so upstream work can be salvaged.
+func respondRunError(w http.ResponseWriter, r *http.Request, e *engine.Engine, err error) {
+	if r.URL.Query().Get("partial") != "true" {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(partialResponse{Error: err.Error(), Results: e.Results()})
+}
+
 func respondJSON(w http.ResponseWriter, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
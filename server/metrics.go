@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the node duration
+// histogram
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// concurrencyBuckets are the upper bounds of the level concurrency histogram
+var concurrencyBuckets = []float64{1, 2, 4, 8, 16, 32, 64, 128}
+
+// metrics collects the engine's run measurements (see engine.WithMetrics)
+// and serves them on /metrics in the Prometheus text exposition format
+type metrics struct {
+	mu               sync.Mutex
+	runs             map[string]uint64
+	nodeFailures     map[string]uint64
+	nodeDurations    map[string]*histogram
+	levelConcurrency *histogram
+}
+
+var _ engine.MetricsCollector = (*metrics)(nil)
+
+func newMetrics() *metrics {
+	return &metrics{
+		runs:             make(map[string]uint64),
+		nodeFailures:     make(map[string]uint64),
+		nodeDurations:    make(map[string]*histogram),
+		levelConcurrency: newHistogram(concurrencyBuckets),
+	}
+}
+
+func (m *metrics) RunStarted(graph string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[graph]++
+}
+
+func (m *metrics) NodeCompleted(nodeID string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.nodeDurations[nodeID]
+	if !ok {
+		h = newHistogram(durationBuckets)
+		m.nodeDurations[nodeID] = h
+	}
+	h.observe(elapsed.Seconds())
+}
+
+func (m *metrics) NodeFailed(nodeID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodeFailures[nodeID]++
+}
+
+func (m *metrics) LevelStarted(level, nodes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.levelConcurrency.observe(float64(nodes))
+}
+
+// ServeHTTP writes every metric in the Prometheus text format
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "graph_runs_total", "counter", "Graph runs started, by graph.")
+	for _, graph := range slices.Sorted(maps.Keys(m.runs)) {
+		fmt.Fprintf(w, "graph_runs_total{graph=%s} %d\n", quote(graph), m.runs[graph])
+	}
+
+	writeHeader(w, "graph_node_failures_total", "counter", "Node failures, by node.")
+	for _, node := range slices.Sorted(maps.Keys(m.nodeFailures)) {
+		fmt.Fprintf(w, "graph_node_failures_total{node=%s} %d\n", quote(node), m.nodeFailures[node])
+	}
+
+	writeHeader(w, "graph_node_duration_seconds", "histogram", "How long nodes ran, by node.")
+	for _, node := range slices.Sorted(maps.Keys(m.nodeDurations)) {
+		m.nodeDurations[node].write(w, "graph_node_duration_seconds", "node="+quote(node)+",")
+	}
+
+	writeHeader(w, "graph_level_concurrency", "histogram", "Nodes run at once per level.")
+	m.levelConcurrency.write(w, "graph_level_concurrency", "")
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quote renders a label value with the escaping the text format requires
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write renders the histogram's series; labels, if any, end with a comma
+func (h *histogram) write(w io.Writer, name, labels string) {
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	suffix := ""
+	if labels != "" {
+		suffix = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, suffix, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, suffix, h.count)
+}
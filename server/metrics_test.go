@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/engine"
+	"github.com/grindlemire/graph-builder/server/pkg/catalog"
+)
+
+func TestMetrics(t *testing.T) {
+	logOutput = io.Discard
+	m := newMetrics()
+	mux := newMux(engine.NewBuilder(catalog.All(), engine.WithMetrics(m)), defaultConfig())
+	mux.Handle("/metrics", m)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for range 2 {
+		resp, err := http.Get(srv.URL + "/graph/small")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, want := range []string{
+		"# TYPE graph_runs_total counter\n",
+		`graph_runs_total{graph="node4"} 2` + "\n",
+		`graph_node_duration_seconds_bucket{node="node1",le="+Inf"} 2` + "\n",
+		`graph_node_duration_seconds_count{node="node4"} 2` + "\n",
+		`graph_level_concurrency_bucket{le="1"} 4` + "\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsCustomGraph(t *testing.T) {
+	logOutput = io.Discard
+	m := newMetrics()
+	mux := newMux(engine.NewBuilder(catalog.All(), engine.WithMetrics(m)), defaultConfig())
+	mux.Handle("/metrics", m)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Client-chosen targets share one series rather than adding one each
+	for _, nodes := range []string{"node4", "node2a,node4", "node4,node2a,node4"} {
+		resp, err := http.Get(srv.URL + "/graph/custom?nodes=" + nodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if want := `graph_runs_total{graph="custom"} 3` + "\n"; !strings.Contains(string(body), want) {
+		t.Errorf("/metrics is missing %q:\n%s", want, body)
+	}
+	if got := strings.Count(string(body), "graph_runs_total{"); got != 1 {
+		t.Errorf("/metrics has %d graph_runs_total series, want 1:\n%s", got, body)
+	}
+}
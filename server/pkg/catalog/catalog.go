@@ -1,27 +1,231 @@
 package catalog
 
-import "github.com/grindlemire/graph-builder/server/pkg/engine"
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
 
 // Global catalog of all available nodes
-var nodes = make(map[string]engine.Node)
+var (
+	nodes = make(map[string]engine.Node)
+	mu    sync.RWMutex
+)
+
+// DisabledEnv names the environment variable holding a comma-separated list of
+// node IDs to disable at startup, e.g. GRAPH_DISABLED_NODES=node2c,node4
+const DisabledEnv = "GRAPH_DISABLED_NODES"
+
+// disabled holds the IDs of nodes turned off by configuration
+var disabled = parseDisabled(os.Getenv(DisabledEnv))
+
+func parseDisabled(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			set[id] = true
+		}
+	}
+	return set
+}
+
+// SetDisabled replaces the set of disabled nodes, which defaults to the IDs
+// listed in $GRAPH_DISABLED_NODES. Tests use it to control the set explicitly.
+func SetDisabled(ids ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	disabled = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		disabled[id] = true
+	}
+}
+
+// Enabled reports whether the node may be used. Pass it to
+// Builder.SetEnabled so builds leave disabled nodes out.
+func Enabled(id string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return !disabled[id]
+}
 
 // Register adds a node to the catalog.
 // Called from init() functions in node packages.
 func Register(node engine.Node) {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if _, exists := nodes[node.ID]; exists {
 		panic("duplicate node registration: " + node.ID)
 	}
 	nodes[node.ID] = node
 }
 
-// Get returns a node by ID
+// RegisterRunnable adds a node implemented as a Runnable to the catalog.
+// Like Register, it is meant to be called from init().
+func RegisterRunnable(r engine.Runnable) {
+	Register(engine.NodeFrom(r))
+}
+
+// Merge adds a batch of nodes to the catalog, e.g. the nodes contributed by a
+// plugin. The merge is all-or-nothing: if any ID collides with a registered
+// node, an alias collides with another node's ID or alias, or a map key
+// doesn't match its node's ID, nothing is added and the returned error lists
+// every offending ID.
+func Merge(other map[string]engine.Node) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var mismatched []string
+	for id, node := range other {
+		if id != node.ID {
+			mismatched = append(mismatched, id)
+		}
+	}
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("node map keys don't match node IDs: %s", strings.Join(mismatched, ", "))
+	}
+
+	// owners maps every ID and alias in use to the node it resolves to, so a
+	// merged node can't make a reference resolve to either of two nodes
+	owners := make(map[string]string)
+	for id, node := range nodes {
+		owners[id] = id
+		for _, alias := range node.Aliases {
+			owners[alias] = id
+		}
+	}
+
+	var collisions, aliasCollisions []string
+	ids := slices.Sorted(maps.Keys(other))
+	for _, id := range ids {
+		if _, exists := nodes[id]; exists {
+			collisions = append(collisions, id)
+			continue
+		}
+		if owner, taken := owners[id]; taken {
+			aliasCollisions = append(aliasCollisions, fmt.Sprintf("%s is an alias of %s", id, owner))
+			continue
+		}
+		owners[id] = id
+	}
+	for _, id := range ids {
+		for _, alias := range other[id].Aliases {
+			if owner, taken := owners[alias]; taken && owner != id {
+				aliasCollisions = append(aliasCollisions, fmt.Sprintf("alias %s of %s is taken by %s", alias, id, owner))
+				continue
+			}
+			owners[alias] = id
+		}
+	}
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("duplicate node registration: %s", strings.Join(collisions, ", "))
+	}
+	if len(aliasCollisions) > 0 {
+		return fmt.Errorf("alias collisions: %s", strings.Join(aliasCollisions, ", "))
+	}
+
+	for id, node := range other {
+		nodes[id] = node
+	}
+	return nil
+}
+
+// Get returns a node by ID or alias
 func Get(id string) (engine.Node, bool) {
-	n, ok := nodes[id]
-	return n, ok
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if n, ok := nodes[id]; ok {
+		return n, true
+	}
+	for _, n := range nodes {
+		if slices.Contains(n.Aliases, id) {
+			return n, true
+		}
+	}
+	return engine.Node{}, false
 }
 
-// All returns the complete node catalog
+// All returns a snapshot of the complete node catalog. Nodes merged after the
+// call are not reflected in the returned map.
 func All() map[string]engine.Node {
-	return nodes
+	mu.RLock()
+	defer mu.RUnlock()
+
+	all := make(map[string]engine.Node, len(nodes))
+	for id, node := range nodes {
+		all[id] = node
+	}
+	return all
 }
 
+// Count returns the number of registered nodes
+func Count() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return len(nodes)
+}
+
+// Stats returns structural statistics over the registered catalog, such as the
+// number of roots and leaves and the longest dependency chain. It doesn't
+// require building or running an engine.
+func Stats() engine.Stats {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return engine.GraphStats(nodes)
+}
+
+// Roots returns the sorted IDs of the registered nodes without dependencies
+func Roots() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return engine.Roots(nodes)
+}
+
+// Leaves returns the sorted IDs of the registered nodes that nothing depends
+// on, i.e. the terminal nodes to build for to run everything meaningful
+func Leaves() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return engine.Leaves(nodes)
+}
+
+// Alias makes a registered node resolvable under an additional ID, e.g. its
+// former ID during a rename so old DependsOn references keep working. Aliases
+// resolve in Get, BuildFor and the engine's scheduling, and PrettyPrint and
+// Engine.AliasUsages point out where they are still used.
+func Alias(existingID, aliasID string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	node, ok := nodes[existingID]
+	if !ok {
+		return fmt.Errorf("cannot alias unknown node: %s", existingID)
+	}
+	if _, taken := nodes[aliasID]; taken {
+		return fmt.Errorf("alias %s is already a registered node", aliasID)
+	}
+	for id, other := range nodes {
+		if slices.Contains(other.Aliases, aliasID) {
+			return fmt.Errorf("alias %s is already an alias of %s", aliasID, id)
+		}
+	}
+
+	node.Aliases = append(slices.Clone(node.Aliases), aliasID)
+	nodes[existingID] = node
+	return nil
+}
@@ -0,0 +1,113 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
+
+// withCatalog replaces the global catalog with the given nodes for the test
+func withCatalog(t *testing.T, registered ...engine.Node) {
+	t.Helper()
+	mu.Lock()
+	saved := nodes
+	nodes = make(map[string]engine.Node)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = saved
+	})
+	for _, node := range registered {
+		Register(node)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	withCatalog(t, engine.Node{ID: "a", Aliases: []string{"old-a"}})
+
+	for _, tc := range []struct {
+		name  string
+		batch map[string]engine.Node
+		err   string
+	}{
+		{"duplicate ID", map[string]engine.Node{"a": {ID: "a"}}, "duplicate node registration: a"},
+		{"ID is an alias", map[string]engine.Node{"old-a": {ID: "old-a"}}, "old-a is an alias of a"},
+		{"alias is an ID", map[string]engine.Node{"b": {ID: "b", Aliases: []string{"a"}}}, "alias a of b is taken by a"},
+		{"alias is an alias", map[string]engine.Node{"b": {ID: "b", Aliases: []string{"old-a"}}}, "alias old-a of b is taken by a"},
+		{"alias within the batch", map[string]engine.Node{
+			"b": {ID: "b"},
+			"c": {ID: "c", Aliases: []string{"b"}},
+		}, "alias b of c is taken by b"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := Merge(tc.batch); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Merge() = %v, want %q", err, tc.err)
+			}
+			if Count() != 1 {
+				t.Errorf("a failed Merge added nodes: %v", All())
+			}
+		})
+	}
+
+	if err := Merge(map[string]engine.Node{"b": {ID: "b", Aliases: []string{"old-b"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if node, ok := Get("old-b"); !ok || node.ID != "b" {
+		t.Errorf("Get(old-b) = %v, %v, want b", node.ID, ok)
+	}
+}
+
+func TestCountAndStats(t *testing.T) {
+	withCatalog(t,
+		engine.Node{ID: "a"},
+		engine.Node{ID: "b", DependsOn: []string{"a"}},
+		engine.Node{ID: "c", DependsOn: []string{"a"}},
+		engine.Node{ID: "d", DependsOn: []string{"b", "c"}},
+	)
+
+	if got := Count(); got != 4 {
+		t.Errorf("Count() = %d, want 4", got)
+	}
+	want := engine.Stats{Nodes: 4, Roots: 1, Leaves: 1, MaxDepth: 3, MaxFanOut: 2}
+	if got := Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestStatsVersionedDeps(t *testing.T) {
+	withCatalog(t,
+		engine.Node{ID: "a", Version: "2"},
+		engine.Node{ID: "b", DependsOn: []string{"a@>=2"}},
+	)
+
+	want := engine.Stats{Nodes: 2, Roots: 1, Leaves: 1, MaxDepth: 2, MaxFanOut: 1}
+	if got := Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	withCatalog(t, engine.Node{ID: "a"}, engine.Node{ID: "b", Aliases: []string{"old-b"}})
+
+	if err := Alias("a", "old-a"); err != nil {
+		t.Fatal(err)
+	}
+	if node, ok := Get("old-a"); !ok || node.ID != "a" {
+		t.Errorf("Get(old-a) = %v, %v, want a", node.ID, ok)
+	}
+
+	for _, tc := range []struct {
+		existing, alias string
+		err             string
+	}{
+		{"missing", "x", "cannot alias unknown node: missing"},
+		{"a", "b", "alias b is already a registered node"},
+		{"a", "old-b", "alias old-b is already an alias of b"},
+	} {
+		if err := Alias(tc.existing, tc.alias); err == nil || err.Error() != tc.err {
+			t.Errorf("Alias(%s, %s) = %v, want %q", tc.existing, tc.alias, err, tc.err)
+		}
+	}
+}
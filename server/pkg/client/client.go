@@ -0,0 +1,83 @@
+// Package client talks to the graph server's HTTP endpoints.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/grindlemire/graph-builder/engine"
+)
+
+// RunIDHeader is the response header carrying the server's run ID
+const RunIDHeader = "X-Run-ID"
+
+// GraphClient calls the graph server. Every call respects its context, so
+// callers control timeouts and cancellation.
+type GraphClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// Response is a decoded graph run
+type Response struct {
+	// RunID identifies the run in the server logs
+	RunID string
+	// Results holds every node's result. Data is decoded from JSON, so
+	// structs arrive as map[string]any.
+	Results map[string]engine.Result
+}
+
+// NewGraphClient returns a client for the server at baseURL, e.g.
+// "http://localhost:8080"
+func NewGraphClient(baseURL string) *GraphClient {
+	return &GraphClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &http.Client{},
+	}
+}
+
+// Small runs the minimal graph (node1 → node4)
+func (c *GraphClient) Small(ctx context.Context) (*Response, error) {
+	return c.get(ctx, "/graph/small")
+}
+
+// Full runs the full graph: every terminal node and all of its dependencies
+func (c *GraphClient) Full(ctx context.Context) (*Response, error) {
+	return c.get(ctx, "/graph/full")
+}
+
+// Custom runs the subgraph needed for the given nodes
+func (c *GraphClient) Custom(ctx context.Context, nodes ...string) (*Response, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("custom graph needs at least one node")
+	}
+	return c.get(ctx, "/graph/custom?nodes="+url.QueryEscape(strings.Join(nodes, ",")))
+}
+
+func (c *GraphClient) get(ctx context.Context, path string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	out := &Response{RunID: resp.Header.Get(RunIDHeader)}
+	if err := json.NewDecoder(resp.Body).Decode(&out.Results); err != nil {
+		return nil, fmt.Errorf("%s: decoding response: %w", path, err)
+	}
+	return out, nil
+}
@@ -1,10 +1,6 @@
 package node2a
 
-import (
-	"fmt"
-
-	"github.com/grindlemire/graph-builder/server/pkg/engine"
-)
+import "github.com/grindlemire/graph-builder/engine"
 
 // Output is the output of the node that other nodes in the graph can use.
 type Output struct {
@@ -15,15 +11,5 @@ type Output struct {
 // from the set of dependencies. This is used by other nodes to easily
 // parse this node's output.
 func FromDeps(deps map[string]engine.Result) (Output, error) {
-	result, ok := deps[ID]
-	if !ok {
-		return Output{}, fmt.Errorf("node2a result not found in deps")
-	}
-
-	output, ok := result.Data.(Output)
-	if !ok {
-		return Output{}, fmt.Errorf("invalid data type for node2a")
-	}
-
-	return output, nil
+	return engine.ResultAs[Output](deps, ID)
 }
@@ -1,10 +1,10 @@
 package node2b
 
 import (
-	"fmt"
+	"context"
 
+	"github.com/grindlemire/graph-builder/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/catalog"
-	"github.com/grindlemire/graph-builder/server/pkg/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/nodes/node1"
 )
 
@@ -25,14 +25,14 @@ func init() {
 
 // run the node's business logic and return a result that can be used
 // by other nodes in the graph. It receives outputs from its dependencies (node1).
-func run(deps map[string]engine.Result) (engine.Result, error) {
+func run(ctx context.Context, deps map[string]engine.Result) (engine.Result, error) {
 	// Extract the output from node1 using its type-safe helper
 	n1, err := node1.FromDeps(deps)
 	if err != nil {
 		return engine.Result{}, err
 	}
 
-	fmt.Printf("  → Running %s (received: %q from node1)\n", ID, n1.Message)
+	engine.Printf(ctx, "  → Running %s (received: %q from node1)\n", ID, n1.Message)
 
 	return engine.Result{
 		ID: ID,
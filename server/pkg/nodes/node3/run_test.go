@@ -0,0 +1,38 @@
+package node3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grindlemire/graph-builder/engine"
+	"github.com/grindlemire/graph-builder/engine/enginetest"
+	"github.com/grindlemire/graph-builder/server/pkg/nodes/node2a"
+	"github.com/grindlemire/graph-builder/server/pkg/nodes/node2b"
+	"github.com/grindlemire/graph-builder/server/pkg/nodes/node2c"
+)
+
+func TestRun(t *testing.T) {
+	deps := enginetest.FakeDeps(
+		engine.Result{ID: node2a.ID, Data: node2a.Output{Message: "a"}},
+		engine.Result{ID: node2b.ID, Data: node2b.Output{Message: "b"}},
+		engine.Result{ID: node2c.ID, Data: node2c.Output{Message: "c"}},
+	)
+
+	result, err := run(context.Background(), deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromDeps(map[string]engine.Result{ID: result}); err != nil {
+		t.Errorf("result is not readable by dependents: %v", err)
+	}
+}
+
+func TestFromDepsReportsActualType(t *testing.T) {
+	deps := enginetest.FakeDeps(engine.Result{ID: node2a.ID, Data: node2b.Output{Message: "b"}})
+
+	_, err := node2a.FromDeps(deps)
+	want := "invalid data type for node2a: expected node2a.Output, got node2b.Output"
+	if err == nil || err.Error() != want {
+		t.Errorf("FromDeps() error = %v, want %q", err, want)
+	}
+}
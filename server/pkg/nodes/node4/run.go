@@ -1,10 +1,10 @@
 package node4
 
 import (
-	"fmt"
+	"context"
 
+	"github.com/grindlemire/graph-builder/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/catalog"
-	"github.com/grindlemire/graph-builder/server/pkg/engine"
 	"github.com/grindlemire/graph-builder/server/pkg/nodes/node1"
 )
 
@@ -16,28 +16,30 @@ const ID = "node4"
 // when the package is imported. This allows us to "automatically" register the node
 // with the catalog at startup.
 func init() {
-	catalog.Register(engine.Node{
+	node, err := engine.TypedNode[input, Output]{
 		ID:        ID,
 		DependsOn: []string{node1.ID},
 		Run:       run,
-	})
-}
-
-// run the node's business logic and return a result that can be used
-// by other nodes in the graph. It receives outputs from its dependencies (node1).
-func run(deps map[string]engine.Result) (engine.Result, error) {
-	// Extract the output from node1 using its type-safe helper
-	n1, err := node1.FromDeps(deps)
+	}.Node()
 	if err != nil {
-		return engine.Result{}, err
+		panic(err)
 	}
+	catalog.Register(node)
+}
+
+// input holds the outputs of the node's dependencies. The engine fills each
+// field from the dependency named in its tag, so no FromDeps call is needed.
+type input struct {
+	N1 node1.Output `dep:"node1"`
+}
 
-	fmt.Printf("  → Running %s (received: %q from node1)\n", ID, n1.Message)
+// run the node's business logic and return its typed output, which the
+// engine stores as the node's result. It receives outputs from its
+// dependencies (node1).
+func run(ctx context.Context, in input) (Output, error) {
+	engine.Printf(ctx, "  → Running %s (received: %q from node1)\n", ID, in.N1.Message)
 
-	return engine.Result{
-		ID: ID,
-		Data: Output{
-			Message: "node4 completed successfully",
-		},
+	return Output{
+		Message: "node4 completed successfully",
 	}, nil
 }